@@ -0,0 +1,82 @@
+package timewheel
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dej4vu/timewheel/internal/redistest"
+	"github.com/dej4vu/timewheel/pkg/backend"
+	"github.com/dej4vu/timewheel/pkg/backend/backendtest"
+	"github.com/dej4vu/timewheel/pkg/backend/memory"
+	"github.com/dej4vu/timewheel/pkg/redis"
+	"github.com/dej4vu/timewheel/pkg/redis/goredis"
+	"github.com/dej4vu/timewheel/pkg/redis/redigo"
+)
+
+func Test_Backend_Memory(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) backend.Backend {
+		return memory.New()
+	})
+}
+
+func Test_Backend_Redigo(t *testing.T) {
+	addr := redistest.StartServer(t)
+	backendtest.Run(t, func(t *testing.T) backend.Backend {
+		return newTestRedisBackend(t, redigo.NewClient(network, addr, ""))
+	})
+}
+
+func Test_Backend_Goredis(t *testing.T) {
+	addr := redistest.StartServer(t)
+	backendtest.Run(t, func(t *testing.T) backend.Backend {
+		return newTestRedisBackend(t, goredis.NewClient(network, addr, ""))
+	})
+}
+
+// mustNewBackend 构造 redis 存储后端，构造失败时终止测试
+func mustNewBackend(t *testing.T, store redis.Store, opts ...redis.BackendOption) *redis.Backend {
+	t.Helper()
+	b, err := redis.NewBackend(store, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// newTestRedisBackend 基于测试启动的 redis-server 构造存储后端，清空其中的数据
+func newTestRedisBackend(t *testing.T, store redis.Store) backend.Backend {
+	return mustNewBackend(t, newTestStore(t, store))
+}
+
+func Test_RTimeWheel_MemoryBackend(t *testing.T) {
+	ctx := context.Background()
+	var (
+		mu       sync.Mutex
+		executed = make(map[string]int)
+	)
+	rTimeWheel := NewRTimeWheelWithBackend(memory.New(), func(ctx context.Context, task *RTaskElement) error {
+		mu.Lock()
+		executed[task.Key]++
+		mu.Unlock()
+		return nil
+	}, WithPollInterval(100*time.Millisecond))
+	defer rTimeWheel.Stop()
+
+	for _, key := range []string{"test1", "test2", "test3"} {
+		if err := rTimeWheel.AddTask(ctx, key, &RTaskElement{Msg: key, Type: "test"}, time.Now().Add(time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rTimeWheel.RemoveTask(ctx, "test2", time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	<-time.After(2 * time.Second)
+	mu.Lock()
+	defer mu.Unlock()
+	if executed["test1"] != 1 || executed["test2"] != 0 || executed["test3"] != 1 {
+		t.Errorf("executed = %v, want test1 and test3 executed once", executed)
+	}
+}
@@ -0,0 +1,149 @@
+package timewheel
+
+import (
+	"container/heap"
+	"errors"
+)
+
+var (
+	// ErrFull 时间轮中的任务数量达到上限
+	ErrFull = errors.New("timewheel: full")
+	// ErrEvicted 任务因时间轮容量不足被淘汰
+	ErrEvicted = errors.New("timewheel: evicted")
+)
+
+// OverflowPolicy 时间轮任务数量达到上限时，新增任务的处理策略
+type OverflowPolicy int
+
+const (
+	// OverflowReject 拒绝新增任务，返回 ErrFull
+	OverflowReject OverflowPolicy = iota
+	// OverflowEvictSoonest 淘汰执行时间最早的任务，为新任务腾出空间
+	OverflowEvictSoonest
+	// OverflowEvictLatest 淘汰执行时间最晚的任务. 新任务的执行时间不早于已有任务时，拒绝新任务
+	OverflowEvictLatest
+	// OverflowBlock 阻塞等待，直到时间轮有空余容量或者 ctx 结束
+	OverflowBlock
+)
+
+// WithMaxTasks 限制时间轮中待执行任务的数量上限，以及达到上限时的处理策略
+func WithMaxTasks(n int, policy OverflowPolicy) Option {
+	return func(t *TimeWheel) {
+		t.maxTasks = n
+		t.overflow = policy
+		switch policy {
+		case OverflowEvictSoonest:
+			t.deadlines = &deadlineHeap{}
+		case OverflowEvictLatest:
+			t.deadlines = &deadlineHeap{latest: true}
+		}
+	}
+}
+
+// deadlineHeap 按照任务执行时间排序的堆，用于快速定位待淘汰的任务
+type deadlineHeap struct {
+	// 为 true 时堆顶为执行时间最晚的任务，否则为最早的任务
+	latest bool
+	tasks  []*taskElement
+}
+
+func (h *deadlineHeap) Len() int { return len(h.tasks) }
+
+func (h *deadlineHeap) Less(i, j int) bool {
+	if h.latest {
+		return h.tasks[i].executeAt.After(h.tasks[j].executeAt)
+	}
+	return h.tasks[i].executeAt.Before(h.tasks[j].executeAt)
+}
+
+func (h *deadlineHeap) Swap(i, j int) {
+	h.tasks[i], h.tasks[j] = h.tasks[j], h.tasks[i]
+	h.tasks[i].heapIdx = i
+	h.tasks[j].heapIdx = j
+}
+
+func (h *deadlineHeap) Push(x any) {
+	task := x.(*taskElement)
+	task.heapIdx = len(h.tasks)
+	h.tasks = append(h.tasks, task)
+}
+
+func (h *deadlineHeap) Pop() any {
+	n := len(h.tasks)
+	task := h.tasks[n-1]
+	h.tasks[n-1] = nil
+	h.tasks = h.tasks[:n-1]
+	task.heapIdx = -1
+	return task
+}
+
+func (h *deadlineHeap) push(task *taskElement) {
+	if h != nil {
+		heap.Push(h, task)
+	}
+}
+
+func (h *deadlineHeap) remove(task *taskElement) {
+	if h != nil && task.heapIdx >= 0 {
+		heap.Remove(h, task.heapIdx)
+	}
+}
+
+func (h *deadlineHeap) top() *taskElement {
+	if h == nil || len(h.tasks) == 0 {
+		return nil
+	}
+	return h.tasks[0]
+}
+
+// admit 在常驻 goroutine 中判断新任务能否挂载，必要时淘汰已有任务
+// 返回 ErrFull 时，阻塞策略下会同时返回一个在容量释放时关闭的 channel
+func (t *TimeWheel) admit(task *taskElement) (<-chan struct{}, error) {
+	if t.maxTasks <= 0 || len(t.keyToETask) < t.maxTasks {
+		return nil, nil
+	}
+	// 覆盖已有任务不会增加任务数量
+	if _, ok := t.keyToETask[task.key]; ok {
+		return nil, nil
+	}
+
+	switch t.overflow {
+	case OverflowEvictSoonest:
+		t.evict(t.deadlines.top())
+		return nil, nil
+	case OverflowEvictLatest:
+		if latest := t.deadlines.top(); latest != nil && latest.executeAt.After(task.executeAt) {
+			t.evict(latest)
+			return nil, nil
+		}
+	case OverflowBlock:
+		// 失败重试的任务不阻塞，避免执行任务的 goroutine 堆积
+		if !task.retry {
+			if t.freec == nil {
+				t.freec = make(chan struct{})
+			}
+			t.counters.rejected.Add(1)
+			return t.freec, ErrFull
+		}
+	}
+	t.counters.rejected.Add(1)
+	return nil, ErrFull
+}
+
+// evict 淘汰任务，并通知 OnRemove 回调
+func (t *TimeWheel) evict(task *taskElement) {
+	if task == nil {
+		return
+	}
+	t.deleteTask(task.key)
+	t.counters.evicted.Add(1)
+	t.hooks.remove(HookEvent{Key: task.key, ExecuteAt: task.executeAt, Err: ErrEvicted})
+}
+
+// release 任务离开时间轮后，唤醒阻塞等待容量的添加方
+func (t *TimeWheel) release() {
+	if t.freec != nil {
+		close(t.freec)
+		t.freec = nil
+	}
+}
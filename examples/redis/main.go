@@ -26,7 +26,7 @@ const (
 
 // 任务处理函数
 func handle(ctx context.Context, task *timewheel.RTaskElement) error {
-	at := time.Unix(task.ExecuteAtUnix, 0).Format(time.DateTime)
+	at := task.ExecuteAt().Format(time.DateTime)
 	slog.Info("get task", slog.Any("key", task.Key), slog.Any("executeAt", at))
 	return nil
 }
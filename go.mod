@@ -5,6 +5,7 @@ go 1.23.0
 require (
 	github.com/demdxx/gocast v1.2.0
 	github.com/gomodule/redigo v1.9.2
+	github.com/yuin/gopher-lua v1.1.1
 )
 
 require (
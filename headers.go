@@ -0,0 +1,110 @@
+package timewheel
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	// HeaderTraceparent W3C Trace Context 中的 traceparent
+	HeaderTraceparent = "traceparent"
+	// HeaderTracestate W3C Trace Context 中的 tracestate
+	HeaderTracestate = "tracestate"
+)
+
+// HeaderCarrier 以任务的 Headers 作为上下文传播的载体
+// 实现了 OpenTelemetry 的 propagation.TextMapCarrier，可以直接用于 propagator 的 Inject、Extract
+type HeaderCarrier map[string]string
+
+// Get 获取 key 对应的值
+func (c HeaderCarrier) Get(key string) string {
+	return c[key]
+}
+
+// Set 设置 key 对应的值
+func (c HeaderCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+// Keys 获取所有的 key
+func (c HeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// traceContextKey context 中保存 W3C Trace Context 的 key
+type traceContextKey struct{}
+
+// traceContext W3C Trace Context
+type traceContext struct {
+	traceparent string
+	tracestate  string
+}
+
+// ContextWithTraceparent 在 context 中保存 W3C traceparent 以及 tracestate，traceparent 不合法时返回原 context
+func ContextWithTraceparent(ctx context.Context, traceparent, tracestate string) context.Context {
+	if !validTraceparent(traceparent) {
+		return ctx
+	}
+	return context.WithValue(ctx, traceContextKey{}, traceContext{traceparent: traceparent, tracestate: tracestate})
+}
+
+// TraceparentFromContext 获取 context 中保存的 W3C traceparent 以及 tracestate
+func TraceparentFromContext(ctx context.Context) (traceparent, tracestate string, ok bool) {
+	tc, ok := ctx.Value(traceContextKey{}).(traceContext)
+	return tc.traceparent, tc.tracestate, ok
+}
+
+// InjectTraceparent 将 context 中的 W3C traceparent 以及 tracestate 写入任务的 Headers
+// context 中保存了 traceparent 时覆盖任务中已有的 traceparent 以及 tracestate，否则保持不变
+// 直接修改 task.Headers，需要保留原 map 时调用方先复制
+func InjectTraceparent(ctx context.Context, task *RTaskElement) {
+	traceparent, tracestate, ok := TraceparentFromContext(ctx)
+	if !ok {
+		return
+	}
+	if task.Headers == nil {
+		task.Headers = make(map[string]string)
+	}
+	task.Headers[HeaderTraceparent] = traceparent
+	if tracestate != "" {
+		task.Headers[HeaderTracestate] = tracestate
+	} else {
+		delete(task.Headers, HeaderTracestate)
+	}
+}
+
+// ExtractTraceparent 将任务 Headers 中的 W3C traceparent 以及 tracestate 保存到 context 中
+func ExtractTraceparent(ctx context.Context, task *RTaskElement) context.Context {
+	return ContextWithTraceparent(ctx, task.Headers[HeaderTraceparent], task.Headers[HeaderTracestate])
+}
+
+// validTraceparent 校验 traceparent 的格式：version-traceid-parentid-flags
+// version 为 ff 以及 trace id、parent id 全为 0 时不合法
+func validTraceparent(traceparent string) bool {
+	parts := strings.Split(traceparent, "-")
+	if len(parts) < 4 {
+		return false
+	}
+	version, traceID, parentID, flags := parts[0], parts[1], parts[2], parts[3]
+	if len(version) != 2 || version == "ff" || len(traceID) != 32 || len(parentID) != 16 || len(flags) != 2 {
+		return false
+	}
+	// 00 版本只有 4 个部分，更高的版本允许追加字段
+	if version == "00" && len(parts) != 4 {
+		return false
+	}
+	for _, part := range []string{version, traceID, parentID, flags} {
+		if strings.ToLower(part) != part {
+			return false
+		}
+		if _, err := hex.DecodeString(part); err != nil {
+			return false
+		}
+	}
+	return strings.Trim(traceID, "0") != "" && strings.Trim(parentID, "0") != ""
+}
@@ -0,0 +1,116 @@
+package timewheel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dej4vu/timewheel/pkg/backend/memory"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func Test_ValidTraceparent(t *testing.T) {
+	for traceparent, want := range map[string]bool{
+		testTraceparent: true,
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra": true,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra": false,
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01":       false,
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01":       false,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01":       false,
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01":       false,
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01":        false,
+		"": false,
+	} {
+		if got := validTraceparent(traceparent); got != want {
+			t.Errorf("validTraceparent(%q) = %v, want %v", traceparent, got, want)
+		}
+	}
+}
+
+func Test_InjectExtractTraceparent(t *testing.T) {
+	ctx := ContextWithTraceparent(context.Background(), testTraceparent, "vendor=1")
+	task := &RTaskElement{Headers: map[string]string{"tenant": "t1"}}
+	InjectTraceparent(ctx, task)
+	if task.Headers[HeaderTraceparent] != testTraceparent || task.Headers[HeaderTracestate] != "vendor=1" || task.Headers["tenant"] != "t1" {
+		t.Fatalf("headers = %v", task.Headers)
+	}
+
+	traceparent, tracestate, ok := TraceparentFromContext(ExtractTraceparent(context.Background(), task))
+	if !ok || traceparent != testTraceparent || tracestate != "vendor=1" {
+		t.Errorf("extracted = %q, %q, %v", traceparent, tracestate, ok)
+	}
+
+	// context 中的 traceparent 覆盖任务中过期的 traceparent 以及 tracestate
+	stale := &RTaskElement{Headers: map[string]string{
+		HeaderTraceparent: "00-11111111111111111111111111111111-2222222222222222-01",
+		HeaderTracestate:  "stale=1",
+	}}
+	InjectTraceparent(ContextWithTraceparent(context.Background(), testTraceparent, ""), stale)
+	if stale.Headers[HeaderTraceparent] != testTraceparent || stale.Headers[HeaderTracestate] != "" {
+		t.Errorf("stale headers = %v", stale.Headers)
+	}
+
+	// 不合法的 traceparent 不会写入
+	InjectTraceparent(ContextWithTraceparent(context.Background(), "invalid", ""), &RTaskElement{})
+	if _, _, ok := TraceparentFromContext(ExtractTraceparent(context.Background(), &RTaskElement{})); ok {
+		t.Error("empty headers should not carry trace context")
+	}
+
+	carrier := HeaderCarrier{}
+	carrier.Set(HeaderTraceparent, testTraceparent)
+	if carrier.Get(HeaderTraceparent) != testTraceparent || len(carrier.Keys()) != 1 {
+		t.Errorf("carrier = %v", carrier)
+	}
+}
+
+func Test_RTimeWheel_Headers(t *testing.T) {
+	type received struct {
+		headers     map[string]string
+		traceparent string
+	}
+	got := make(chan received, 2)
+	mux := NewMux()
+	mux.Handle("test", func(ctx context.Context, task *RTaskElement) error {
+		traceparent, _, _ := TraceparentFromContext(ctx)
+		got <- received{headers: task.Headers, traceparent: traceparent}
+		return nil
+	})
+	HandleTypedFunc(mux, func(ctx context.Context, payload orderTimeout) error {
+		traceparent, _, _ := TraceparentFromContext(ctx)
+		got <- received{traceparent: traceparent}
+		return nil
+	})
+	rTimeWheel := NewRTimeWheelWithBackend(memory.New(), mux.Execute, WithPollInterval(100*time.Millisecond))
+	defer rTimeWheel.Stop()
+
+	ctx := ContextWithTraceparent(context.Background(), testTraceparent, "")
+	executeAt := time.Now().Add(300 * time.Millisecond)
+	headers := map[string]string{"tenant": "t1"}
+	if err := rTimeWheel.AddTask(ctx, "test", &RTaskElement{
+		Msg: "msg", Type: "test", Headers: headers,
+	}, executeAt); err != nil {
+		t.Fatal(err)
+	}
+	// 调用方传入的 Headers 不会被修改
+	if len(headers) != 1 {
+		t.Errorf("caller headers modified: %v", headers)
+	}
+	if err := AddTyped(ctx, rTimeWheel, "typed", orderTimeout{OrderID: "o1"}, executeAt, WithHeaders(map[string]string{"tenant": "t2"})); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case r := <-got:
+			if r.traceparent != testTraceparent {
+				t.Errorf("traceparent = %q, want %q", r.traceparent, testTraceparent)
+			}
+			if r.headers != nil && r.headers["tenant"] != "t1" {
+				t.Errorf("headers = %v", r.headers)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("task not executed")
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package timewheel
+
+import "time"
+
+// HookEvent 时间轮生命周期事件的明细
+type HookEvent struct {
+	// 定时任务的唯一标识键
+	Key string
+	// 任务预期的执行时间
+	ExecuteAt time.Time
+	// 任务实际被触发的时间，仅在 OnFire、OnPanic 中有值
+	FiredAt time.Time
+	// 任务执行返回的错误，或 panic 转换而来的错误
+	Err error
+}
+
+// Hooks 时间轮生命周期回调，各回调均为可选项
+// 回调由时间轮内部 goroutine 同步调用，实现方应尽快返回，避免阻塞时间轮
+type Hooks struct {
+	// 新增任务时回调
+	OnAdd func(HookEvent)
+	// 以相同 key 添加任务，覆盖已有任务时回调
+	OnReplace func(HookEvent)
+	// 删除任务时回调
+	OnRemove func(HookEvent)
+	// 任务执行完成时回调
+	OnFire func(HookEvent)
+	// 任务执行发生 panic 时回调
+	OnPanic func(HookEvent)
+}
+
+func (h *Hooks) add(e HookEvent) {
+	if h != nil && h.OnAdd != nil {
+		h.OnAdd(e)
+	}
+}
+
+func (h *Hooks) replace(e HookEvent) {
+	if h != nil && h.OnReplace != nil {
+		h.OnReplace(e)
+	}
+}
+
+func (h *Hooks) remove(e HookEvent) {
+	if h != nil && h.OnRemove != nil {
+		h.OnRemove(e)
+	}
+}
+
+func (h *Hooks) fire(e HookEvent) {
+	if h != nil && h.OnFire != nil {
+		h.OnFire(e)
+	}
+}
+
+func (h *Hooks) panic(e HookEvent) {
+	if h != nil && h.OnPanic != nil {
+		h.OnPanic(e)
+	}
+}
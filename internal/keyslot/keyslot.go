@@ -0,0 +1,33 @@
+// Package keyslot 按照 redis cluster 规范计算 key 所属的 slot
+package keyslot
+
+import "strings"
+
+// Slots redis cluster 的 slot 总数
+const Slots = 16384
+
+// Of 计算 key 所属的 slot，存在 hash tag 时只对 hash tag 计算
+func Of(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key)) % Slots
+}
+
+// crc16 redis cluster 使用的 CRC16-CCITT(XMODEM) 校验算法
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
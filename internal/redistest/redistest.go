@@ -0,0 +1,141 @@
+// Package redistest 提供测试使用的本地 redis-server 启动工具
+package redistest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dej4vu/timewheel/internal/keyslot"
+	"github.com/redis/go-redis/v9"
+)
+
+// ClusterSlots redis cluster 的 slot 总数
+const ClusterSlots = keyslot.Slots
+
+// StartServer 在本地随机端口启动一个 redis-server，测试结束后自动关闭
+// 未安装 redis-server 时跳过测试
+func StartServer(t testing.TB, args ...string) string {
+	t.Helper()
+
+	bin, err := exec.LookPath("redis-server")
+	if err != nil {
+		t.Skip("redis-server not found in PATH")
+	}
+
+	port := freePort(t)
+	dir := t.TempDir()
+	cmdArgs := append([]string{
+		"--port", strconv.Itoa(port),
+		"--bind", "127.0.0.1",
+		"--dir", dir,
+		"--save", "",
+		"--appendonly", "no",
+	}, args...)
+	cmd := exec.Command(bin, cmdArgs...)
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start redis-server: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	rdb := redis.NewClient(&redis.Options{Addr: addr})
+	defer rdb.Close()
+	waitFor(t, func(ctx context.Context) bool {
+		return rdb.Ping(ctx).Err() == nil
+	})
+	return addr
+}
+
+// StartCluster 在本地启动由 n 个主节点组成的 redis cluster，slot 均匀分配到各个节点
+// 未安装 redis-server 时跳过测试
+func StartCluster(t testing.TB, n int) []string {
+	t.Helper()
+
+	addrs := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		dir := t.TempDir()
+		addrs = append(addrs, StartServer(t,
+			"--cluster-enabled", "yes",
+			"--cluster-config-file", filepath.Join(dir, "nodes.conf"),
+		))
+	}
+
+	ctx := context.Background()
+	for i, addr := range addrs {
+		rdb := redis.NewClient(&redis.Options{Addr: addr})
+		start, end := i*ClusterSlots/n, (i+1)*ClusterSlots/n
+		slots := make([]int, 0, end-start)
+		for slot := start; slot < end; slot++ {
+			slots = append(slots, slot)
+		}
+		if err := rdb.ClusterAddSlots(ctx, slots...).Err(); err != nil {
+			t.Fatalf("cluster addslots: %v", err)
+		}
+		if i > 0 {
+			host, port, _ := net.SplitHostPort(addr)
+			seed := redis.NewClient(&redis.Options{Addr: addrs[0]})
+			if err := seed.ClusterMeet(ctx, host, port).Err(); err != nil {
+				t.Fatalf("cluster meet: %v", err)
+			}
+			_ = seed.Close()
+		}
+		_ = rdb.Close()
+	}
+
+	for _, addr := range addrs {
+		rdb := redis.NewClient(&redis.Options{Addr: addr})
+		waitFor(t, func(ctx context.Context) bool {
+			info, err := rdb.ClusterInfo(ctx).Result()
+			return err == nil && strings.Contains(info, "cluster_state:ok")
+		})
+		_ = rdb.Close()
+	}
+	return addrs
+}
+
+// KeySlot 按照 redis cluster 规范计算 key 所属的 slot，存在 hash tag 时只对 hash tag 计算
+func KeySlot(key string) int {
+	return keyslot.Of(key)
+}
+
+// freePort 获取一个本地空闲端口. cluster 总线端口为 port+10000，因此端口不超过 55535
+func freePort(t testing.TB) int {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		port := l.Addr().(*net.TCPAddr).Port
+		_ = l.Close()
+		if port <= 55535 {
+			return port
+		}
+	}
+	t.Fatal("no free port")
+	return 0
+}
+
+// waitFor 等待条件满足，超时后测试失败
+func waitFor(t testing.TB, cond func(ctx context.Context) bool) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for !cond(ctx) {
+		select {
+		case <-ctx.Done():
+			t.Fatal("wait for redis-server timeout")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
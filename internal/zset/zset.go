@@ -0,0 +1,149 @@
+// Package zset 实现与 redis 有序集合语义一致的内存有序集合
+package zset
+
+import (
+	"math"
+	"sort"
+)
+
+// Member 有序集合中的元素
+type Member struct {
+	Name  string
+	Score float64
+}
+
+// less 与 redis 一致，先按照 score 排序，score 相同时按照元素的字典序排序
+func (m Member) less(o Member) bool {
+	if m.Score != o.Score {
+		return m.Score < o.Score
+	}
+	return m.Name < o.Name
+}
+
+// Bound score 区间的边界
+type Bound struct {
+	Score float64
+	// 是否为开区间
+	Exclusive bool
+}
+
+// Inclusive 闭区间边界
+func Inclusive(score float64) Bound {
+	return Bound{Score: score}
+}
+
+// Exclusive 开区间边界
+func Exclusive(score float64) Bound {
+	return Bound{Score: score, Exclusive: true}
+}
+
+var (
+	// NegInf 负无穷
+	NegInf = Inclusive(math.Inf(-1))
+	// PosInf 正无穷
+	PosInf = Inclusive(math.Inf(1))
+)
+
+func (b Bound) aboveMin(score float64) bool {
+	if b.Exclusive {
+		return score > b.Score
+	}
+	return score >= b.Score
+}
+
+func (b Bound) belowMax(score float64) bool {
+	if b.Exclusive {
+		return score < b.Score
+	}
+	return score <= b.Score
+}
+
+// Set 有序集合，非并发安全
+type Set struct {
+	scores  map[string]float64
+	members []Member
+}
+
+// New 构造空的有序集合
+func New() *Set {
+	return &Set{scores: make(map[string]float64)}
+}
+
+// Len 元素数量
+func (s *Set) Len() int {
+	return len(s.members)
+}
+
+// Score 获取元素的 score
+func (s *Set) Score(name string) (float64, bool) {
+	score, ok := s.scores[name]
+	return score, ok
+}
+
+// Add 添加元素，元素已存在时更新 score. 返回是否为新增的元素
+func (s *Set) Add(name string, score float64) bool {
+	_, exists := s.scores[name]
+	if exists {
+		s.Rem(name)
+	}
+
+	m := Member{Name: name, Score: score}
+	i := sort.Search(len(s.members), func(i int) bool { return m.less(s.members[i]) })
+	s.members = append(s.members, Member{})
+	copy(s.members[i+1:], s.members[i:])
+	s.members[i] = m
+	s.scores[name] = score
+	return !exists
+}
+
+// Rem 删除元素，返回元素是否存在
+func (s *Set) Rem(name string) bool {
+	score, ok := s.scores[name]
+	if !ok {
+		return false
+	}
+	m := Member{Name: name, Score: score}
+	i := sort.Search(len(s.members), func(i int) bool { return !s.members[i].less(m) })
+	s.members = append(s.members[:i], s.members[i+1:]...)
+	delete(s.scores, name)
+	return true
+}
+
+// RangeByScore 按照顺序获取 score 在 [min, max] 区间内的元素，跳过前 offset 个，limit 小于 0 时不限制数量
+func (s *Set) RangeByScore(min, max Bound, offset, limit int) []Member {
+	i := sort.Search(len(s.members), func(i int) bool { return min.aboveMin(s.members[i].Score) })
+	var result []Member
+	for i += offset; i < len(s.members) && limit != 0; i++ {
+		if !max.belowMax(s.members[i].Score) {
+			break
+		}
+		result = append(result, s.members[i])
+		limit--
+	}
+	return result
+}
+
+// Range 按照排名获取 [start, stop] 区间内的元素，负数表示倒数的排名
+func (s *Set) Range(start, stop int) []Member {
+	n := len(s.members)
+	if start < 0 {
+		start = max(n+start, 0)
+	}
+	if stop < 0 {
+		stop = n + stop
+	}
+	stop = min(stop, n-1)
+	if start > stop {
+		return nil
+	}
+	return append([]Member(nil), s.members[start:stop+1]...)
+}
+
+// RemRangeByScore 删除 score 在 [min, max] 区间内的元素，返回删除的数量
+func (s *Set) RemRangeByScore(min, max Bound) int {
+	members := s.RangeByScore(min, max, 0, -1)
+	for _, m := range members {
+		s.Rem(m.Name)
+	}
+	return len(members)
+}
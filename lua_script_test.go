@@ -0,0 +1,222 @@
+package timewheel
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dej4vu/timewheel/pkg/backend"
+	"github.com/dej4vu/timewheel/pkg/backend/backendtest"
+	"github.com/dej4vu/timewheel/pkg/redis"
+	"github.com/dej4vu/timewheel/pkg/redis/fake"
+	"github.com/demdxx/gocast"
+)
+
+func Test_Backend_Fake(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) backend.Backend {
+		return mustNewBackend(t, fake.New())
+	})
+}
+
+func Test_LuaScript_NoScript(t *testing.T) {
+	ctx := context.Background()
+	store := fake.New()
+
+	if _, err := store.EvalSha(ctx, redis.GetWatermarkScript.Hash(), []string{redis.WatermarkKey}, nil); !redis.IsNoScript(err) {
+		t.Fatalf("evalsha before load err = %v, want NOSCRIPT", err)
+	}
+	if reply, err := redis.GetWatermarkScript.Run(ctx, store, []string{redis.WatermarkKey}, nil); err != nil || gocast.ToInt(reply) != 0 {
+		t.Fatalf("run = %v, %v, want 0", reply, err)
+	}
+	// EVAL 之后脚本已缓存
+	if _, err := store.EvalSha(ctx, redis.GetWatermarkScript.Hash(), []string{redis.WatermarkKey}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Eval(ctx, "return redis.call('zadd', KEYS[1], 'x', 'member')", []string{"k"}, nil); err == nil {
+		t.Error("invalid score should fail")
+	}
+}
+
+func Test_LuaScript_DeleteTask(t *testing.T) {
+	ctx := context.Background()
+	store := fake.New()
+	b := mustNewBackend(t, store)
+
+	executeAt := time.Now().Add(time.Minute)
+	deleteSetKey := redis.DeleteSetKey(executeAt)
+	if err := b.Remove(ctx, "a", executeAt); err != nil {
+		t.Fatal(err)
+	}
+	// 删除集合的过期时间为执行时间之后 1 小时，只在写入首个元素时设置
+	if ttl := store.TTL(deleteSetKey); ttl < time.Hour || ttl > time.Hour+time.Minute {
+		t.Fatalf("ttl = %v, want about 1h1m", ttl)
+	}
+	store.FastForward(10 * time.Minute)
+	if err := b.Remove(ctx, "b", executeAt); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := store.TTL(deleteSetKey); ttl > time.Hour-5*time.Minute {
+		t.Fatalf("ttl = %v, should not be refreshed", ttl)
+	}
+
+	// 重新添加任务时清除删除标识
+	if _, err := b.Add(ctx, backend.Task{Key: "a", ExecuteAt: executeAt, Body: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if members, err := store.Do(ctx, "SMEMBERS", deleteSetKey); err != nil || !reflect.DeepEqual(members, []interface{}{"b"}) {
+		t.Fatalf("members = %v, %v, want [b]", members, err)
+	}
+
+	store.FastForward(time.Hour)
+	if ttl := store.TTL(deleteSetKey); ttl != -2 {
+		t.Fatalf("ttl = %v, delete set should be expired", ttl)
+	}
+}
+
+func Test_LuaScript_RangeTasks(t *testing.T) {
+	ctx := context.Background()
+	store := fake.New()
+	b := mustNewBackend(t, store)
+
+	minute := time.Now().Add(time.Hour).Truncate(time.Minute)
+	// 历史版本写入的任务以秒级时间戳作为 score
+	for i, key := range []string{"legacy1", "legacy2"} {
+		at := minute.Add(time.Duration(i+1) * time.Second)
+		if _, err := store.Do(ctx, "ZADD", redis.MinuteSliceKey(minute), at.Unix(), key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, key := range []string{"ms1", "ms2"} {
+		at := minute.Add(time.Duration(i+1)*time.Second + 500*time.Millisecond)
+		if _, err := b.Add(ctx, backend.Task{Key: key, ExecuteAt: at, Body: key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lease := time.Now().Add(time.Minute)
+	// 优先取出历史任务，剩余额度取出毫秒级任务
+	claimed, err := b.Claim(ctx, minute, minute, minute.Add(time.Minute), 3, lease)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"legacy1", "legacy2", "ms1"}; !reflect.DeepEqual(claimed.Bodies, want) {
+		t.Fatalf("bodies = %v, want %v", claimed.Bodies, want)
+	}
+	if score, err := store.Do(ctx, "ZRANGE", redis.ProcessingKey(minute), 0, -1, "WITHSCORES"); err != nil ||
+		gocast.ToInt64(gocast.ToInterfaceSlice(score)[1]) != lease.UnixMilli() {
+		t.Fatalf("processing = %v, %v, want lease %d", score, err, lease.UnixMilli())
+	}
+	// 处理中的 zset 以及取出次数的 hash 在租约到期之后 backend.ProcessingTTL 过期
+	for _, key := range []string{redis.ProcessingKey(minute), redis.DeliveriesKey(minute)} {
+		if ttl := store.TTL(key); ttl <= backend.ProcessingTTL || ttl > backend.ProcessingTTL+time.Minute {
+			t.Fatalf("%s ttl = %v, want about %v", key, ttl, backend.ProcessingTTL+time.Minute)
+		}
+	}
+
+	claimed, err = b.Claim(ctx, minute, minute, minute.Add(time.Minute), 3, lease)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"ms2"}; !reflect.DeepEqual(claimed.Bodies, want) {
+		t.Fatalf("bodies = %v, want %v", claimed.Bodies, want)
+	}
+	// 全部取出后时间片 zset 被删除
+	if ttl := store.TTL(redis.MinuteSliceKey(minute)); ttl != -2 {
+		t.Fatalf("minute slice should be removed, ttl = %v", ttl)
+	}
+
+	if err := b.Ack(ctx, minute, backend.Task{Body: "legacy1"}, backend.Task{Body: "legacy2"}, backend.Task{Body: "ms1"}, backend.Task{Body: "ms2"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{redis.ProcessingKey(minute), redis.DeliveriesKey(minute)} {
+		if ttl := store.TTL(key); ttl != -2 {
+			t.Fatalf("%s should be removed, ttl = %v", key, ttl)
+		}
+	}
+}
+
+func Test_LuaScript_Watermark(t *testing.T) {
+	ctx := context.Background()
+	store := fake.New()
+	b := mustNewBackend(t, store)
+
+	// 历史版本记录的秒级水位
+	legacy := time.Now().Add(-time.Minute).Unix()
+	if _, err := store.Do(ctx, "SET", redis.WatermarkKey, legacy); err != nil {
+		t.Fatal(err)
+	}
+	if watermark, err := b.Watermark(ctx); err != nil || !watermark.Equal(time.Unix(legacy, 0)) {
+		t.Fatalf("watermark = %v, %v, want %v", watermark, err, time.Unix(legacy, 0))
+	}
+
+	// 毫秒级水位总是大于秒级水位
+	now := time.UnixMilli(time.Now().UnixMilli())
+	if err := b.AdvanceWatermark(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	if watermark, err := b.Watermark(ctx); err != nil || !watermark.Equal(now) {
+		t.Fatalf("watermark = %v, %v, want %v", watermark, err, now)
+	}
+}
+
+func Test_LuaScript_Leader(t *testing.T) {
+	ctx := context.Background()
+	store := fake.New()
+	b := mustNewBackend(t, store)
+
+	token, err := b.AcquireLeader(ctx, "a", time.Minute)
+	if err != nil || token != 1 {
+		t.Fatalf("token = %d, %v, want 1", token, err)
+	}
+	if token, err := b.AcquireLeader(ctx, "b", time.Minute); err != nil || token != 0 {
+		t.Fatalf("token = %d, %v, want 0", token, err)
+	}
+
+	// 租约过期后其他实例接管，fencing token 递增
+	store.FastForward(time.Minute)
+	if token, err := b.AcquireLeader(ctx, "b", time.Minute); err != nil || token != 2 {
+		t.Fatalf("token = %d, %v, want 2", token, err)
+	}
+	if err := b.ReleaseLeader(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if holder, err := store.Do(ctx, "GET", redis.LeaderKey); err != nil || holder != "b" {
+		t.Fatalf("holder = %v, %v, want b", holder, err)
+	}
+}
+
+func Test_RTimeWheel_Fake(t *testing.T) {
+	ctx := context.Background()
+	var (
+		mu       sync.Mutex
+		executed = make(map[string]int)
+	)
+	rTimeWheel := NewRTimeWheel(fake.New(), func(ctx context.Context, task *RTaskElement) error {
+		mu.Lock()
+		executed[task.Key]++
+		mu.Unlock()
+		return nil
+	}, WithPollInterval(100*time.Millisecond))
+	defer rTimeWheel.Stop()
+
+	executeAt := time.Now().Add(time.Second)
+	for i := 0; i < 3; i++ {
+		key := fmt.Sprintf("test%d", i)
+		if err := rTimeWheel.AddTask(ctx, key, &RTaskElement{Msg: key, Type: "test"}, executeAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rTimeWheel.RemoveTask(ctx, "test1", executeAt); err != nil {
+		t.Fatal(err)
+	}
+
+	<-time.After(2 * time.Second)
+	mu.Lock()
+	defer mu.Unlock()
+	if want := map[string]int{"test0": 1, "test2": 1}; !reflect.DeepEqual(executed, want) {
+		t.Errorf("executed = %v, want %v", executed, want)
+	}
+}
@@ -0,0 +1,186 @@
+package timewheel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ErrUnknownType 任务类型没有注册处理函数
+var ErrUnknownType = errors.New("timewheel: unknown task type")
+
+// permanentError 不可重试的错误
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent 将错误标记为不可重试. 处理函数返回该错误时，分布式时间轮不再重试，直接将任务转入死信队列
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// isPermanent 错误是否被标记为不可重试
+func isPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// HandlerFunc 任务处理函数
+type HandlerFunc func(ctx context.Context, task *RTaskElement) error
+
+// UnknownTypePolicy 任务类型没有注册处理函数时的处理方式
+type UnknownTypePolicy int
+
+const (
+	// UnknownTypeError 返回 ErrUnknownType，任务按照重试策略重试，未设置重试策略时在租约过期后重新执行
+	UnknownTypeError UnknownTypePolicy = iota
+	// UnknownTypeLog 记录日志后丢弃任务
+	UnknownTypeLog
+	// UnknownTypeDeadLetter 直接将任务转入死信队列
+	UnknownTypeDeadLetter
+)
+
+// MuxOption Mux 的可选配置
+type MuxOption func(m *Mux)
+
+// WithUnknownTypePolicy 设置任务类型没有注册处理函数时的处理方式，默认为 UnknownTypeError
+func WithUnknownTypePolicy(policy UnknownTypePolicy) MuxOption {
+	return func(m *Mux) {
+		m.unknownTypePolicy = policy
+	}
+}
+
+// WithDefaultHandler 设置任务类型没有注册处理函数时使用的处理函数，设置后不再使用 UnknownTypePolicy
+func WithDefaultHandler(handler HandlerFunc) MuxOption {
+	return func(m *Mux) {
+		m.defaultHandler = handler
+	}
+}
+
+// HandlerOption 单个任务类型的可选配置
+type HandlerOption func(h *muxEntry)
+
+// WithHandlerTimeout 设置任务类型的处理超时时间，超时后处理函数的 ctx 被取消
+func WithHandlerTimeout(timeout time.Duration) HandlerOption {
+	return func(h *muxEntry) {
+		if timeout > 0 {
+			h.timeout = timeout
+		}
+	}
+}
+
+// WithHandlerConcurrency 设置任务类型并发执行的数量上限
+// 达到上限时任务等待其他任务执行完成，等待期间占用时间轮的 worker
+func WithHandlerConcurrency(n int) HandlerOption {
+	return func(h *muxEntry) {
+		if n > 0 {
+			h.sem = make(chan struct{}, n)
+		}
+	}
+}
+
+// muxEntry 任务类型对应的处理函数以及配置
+type muxEntry struct {
+	handler HandlerFunc
+	// 处理超时时间，为 0 时不限制
+	timeout time.Duration
+	// 并发执行的令牌，为空时不限制
+	sem chan struct{}
+}
+
+// Mux 按照任务类型分发任务的处理函数，并发安全
+// Mux.Execute 可以直接作为 NewRTimeWheel 的处理函数：
+//
+//	mux := NewMux()
+//	mux.Handle("order_timeout", handleOrderTimeout, WithHandlerTimeout(time.Second))
+//	rTimeWheel := NewRTimeWheel(store, mux.Execute)
+type Mux struct {
+	mu                sync.RWMutex
+	entries           map[string]*muxEntry
+	unknownTypePolicy UnknownTypePolicy
+	defaultHandler    HandlerFunc
+}
+
+// NewMux 构造任务处理函数的分发器
+func NewMux(opts ...MuxOption) *Mux {
+	m := &Mux{entries: make(map[string]*muxEntry)}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Handle 注册任务类型对应的处理函数. 任务类型为空、处理函数为空或者重复注册时 panic
+func (m *Mux) Handle(taskType string, handler HandlerFunc, opts ...HandlerOption) {
+	if taskType == "" {
+		panic("timewheel: empty task type")
+	}
+	if handler == nil {
+		panic("timewheel: nil handler")
+	}
+
+	entry := &muxEntry{handler: handler}
+	for _, opt := range opts {
+		opt(entry)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.entries[taskType]; ok {
+		panic("timewheel: multiple registrations for task type " + taskType)
+	}
+	m.entries[taskType] = entry
+}
+
+// Execute 按照任务类型执行对应的处理函数
+func (m *Mux) Execute(ctx context.Context, task *RTaskElement) error {
+	m.mu.RLock()
+	entry, ok := m.entries[task.Type]
+	m.mu.RUnlock()
+	if !ok {
+		return m.unknownType(ctx, task)
+	}
+
+	if entry.sem != nil {
+		select {
+		case entry.sem <- struct{}{}:
+			defer func() { <-entry.sem }()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if entry.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, entry.timeout)
+		defer cancel()
+	}
+	return entry.handler(ctx, task)
+}
+
+// unknownType 处理没有注册处理函数的任务
+func (m *Mux) unknownType(ctx context.Context, task *RTaskElement) error {
+	if m.defaultHandler != nil {
+		return m.defaultHandler(ctx, task)
+	}
+
+	err := fmt.Errorf("%w: %s", ErrUnknownType, task.Type)
+	switch m.unknownTypePolicy {
+	case UnknownTypeLog:
+		log.Warn("drop task of unknown type", slog.Any("task key", task.Key), slog.Any("task type", task.Type))
+		return nil
+	case UnknownTypeDeadLetter:
+		return Permanent(err)
+	default:
+		return err
+	}
+}
@@ -0,0 +1,142 @@
+package timewheel
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dej4vu/timewheel/pkg/backend/memory"
+)
+
+func Test_Mux_Execute(t *testing.T) {
+	ctx := context.Background()
+	mux := NewMux()
+	var got []string
+	for _, taskType := range []string{"a", "b"} {
+		taskType := taskType
+		mux.Handle(taskType, func(ctx context.Context, task *RTaskElement) error {
+			got = append(got, taskType+":"+task.Key)
+			return nil
+		})
+	}
+
+	for _, task := range []*RTaskElement{{Key: "1", Type: "a"}, {Key: "2", Type: "b"}} {
+		if err := mux.Execute(ctx, task); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(got) != 2 || got[0] != "a:1" || got[1] != "b:2" {
+		t.Errorf("got = %v, want [a:1 b:2]", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("duplicate registration should panic")
+		}
+	}()
+	mux.Handle("a", func(ctx context.Context, task *RTaskElement) error { return nil })
+}
+
+func Test_Mux_UnknownType(t *testing.T) {
+	ctx := context.Background()
+	task := &RTaskElement{Key: "1", Type: "unknown"}
+
+	if err := NewMux().Execute(ctx, task); !errors.Is(err, ErrUnknownType) || isPermanent(err) {
+		t.Errorf("error policy err = %v, want ErrUnknownType", err)
+	}
+	if err := NewMux(WithUnknownTypePolicy(UnknownTypeLog)).Execute(ctx, task); err != nil {
+		t.Errorf("log policy err = %v, want nil", err)
+	}
+	if err := NewMux(WithUnknownTypePolicy(UnknownTypeDeadLetter)).Execute(ctx, task); !errors.Is(err, ErrUnknownType) || !isPermanent(err) {
+		t.Errorf("dead letter policy err = %v, want permanent ErrUnknownType", err)
+	}
+
+	called := false
+	mux := NewMux(WithUnknownTypePolicy(UnknownTypeDeadLetter), WithDefaultHandler(func(ctx context.Context, task *RTaskElement) error {
+		called = true
+		return nil
+	}))
+	if err := mux.Execute(ctx, task); err != nil || !called {
+		t.Errorf("default handler err = %v, called = %v", err, called)
+	}
+}
+
+func Test_Mux_TimeoutAndConcurrency(t *testing.T) {
+	ctx := context.Background()
+	mux := NewMux()
+	mux.Handle("slow", func(ctx context.Context, task *RTaskElement) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, WithHandlerTimeout(50*time.Millisecond))
+
+	var running, peak atomic.Int32
+	mux.Handle("limited", func(ctx context.Context, task *RTaskElement) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}, WithHandlerConcurrency(2))
+
+	if err := mux.Execute(ctx, &RTaskElement{Type: "slow"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want deadline exceeded", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := mux.Execute(ctx, &RTaskElement{Type: "limited"}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if p := peak.Load(); p != 2 {
+		t.Errorf("peak concurrency = %d, want 2", p)
+	}
+}
+
+func Test_RTimeWheel_Mux(t *testing.T) {
+	ctx := context.Background()
+	var executed atomic.Int32
+	mux := NewMux(WithUnknownTypePolicy(UnknownTypeDeadLetter))
+	mux.Handle("known", func(ctx context.Context, task *RTaskElement) error {
+		executed.Add(1)
+		return nil
+	})
+
+	rTimeWheel := NewRTimeWheelWithBackend(memory.New(), mux.Execute, WithPollInterval(100*time.Millisecond))
+	defer rTimeWheel.Stop()
+
+	executeAt := time.Now().Add(500 * time.Millisecond)
+	if err := rTimeWheel.AddTask(ctx, "known", &RTaskElement{Msg: "known", Type: "known"}, executeAt); err != nil {
+		t.Fatal(err)
+	}
+	if err := rTimeWheel.AddTask(ctx, "unknown", &RTaskElement{Msg: "unknown", Type: "unknown"}, executeAt); err != nil {
+		t.Fatal(err)
+	}
+
+	<-time.After(1500 * time.Millisecond)
+	if n := executed.Load(); n != 1 {
+		t.Errorf("executed = %d, want 1", n)
+	}
+	// 未设置重试策略时，未知类型的任务也直接转入死信队列
+	deadLetters, err := rTimeWheel.ListDeadLetters(ctx, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deadLetters) != 1 || deadLetters[0].Task.Key != "unknown" || !strings.Contains(deadLetters[0].Error, ErrUnknownType.Error()) {
+		t.Errorf("dead letters = %+v, want unknown task", deadLetters)
+	}
+}
@@ -0,0 +1,128 @@
+package timewheel
+
+import "time"
+
+// Option 单机版时间轮的可选配置
+type Option func(t *TimeWheel)
+
+// ROption redis 版时间轮的可选配置
+type ROption func(r *RTimeWheel)
+
+// WithHooks 设置单机版时间轮的生命周期回调
+func WithHooks(hooks Hooks) Option {
+	return func(t *TimeWheel) {
+		t.hooks = &hooks
+	}
+}
+
+// WithRHooks 设置 redis 版时间轮的生命周期回调
+func WithRHooks(hooks Hooks) ROption {
+	return func(r *RTimeWheel) {
+		r.hooks = &hooks
+	}
+}
+
+// WithVisibilityTimeout 设置 redis 版时间轮的任务租约时长
+// 任务被取出后需要在租约内处理完成，否则租约过期后会被存活的实例回收并重新执行
+func WithVisibilityTimeout(timeout time.Duration) ROption {
+	return func(r *RTimeWheel) {
+		if timeout > 0 {
+			r.visibilityTimeout = timeout
+		}
+	}
+}
+
+// WithReclaimWindow 设置回收租约过期任务的时间窗口，只回收执行时间在窗口内的任务
+func WithReclaimWindow(window time.Duration) ROption {
+	return func(r *RTimeWheel) {
+		if window > 0 {
+			r.reclaimWindow = window
+		}
+	}
+}
+
+// WithMaxDeliveries 设置同一任务被取出次数的上限，默认 10 次. 租约过期后回收重新执行同样计入取出次数
+// 超过上限的任务不再执行，转入死信队列并触发重试策略的最终失败回调.
+// 上限与租约时长的乘积需要小于回收时间窗口，否则任务在达到上限前就已不再回收，只能等待存储后端清理
+func WithMaxDeliveries(n int) ROption {
+	return func(r *RTimeWheel) {
+		if n > 0 {
+			r.maxDeliveries = n
+		}
+	}
+}
+
+// WithRetryPolicy 设置 redis 版时间轮中某一任务类型的重试策略，taskType 为空字符串时作为默认策略
+// 重试耗尽或者错误不可重试时，任务转入死信队列
+func WithRetryPolicy(taskType string, policy *RetryPolicy) ROption {
+	return func(r *RTimeWheel) {
+		if r.retryPolicies == nil {
+			r.retryPolicies = make(map[string]*RetryPolicy)
+		}
+		r.retryPolicies[taskType] = policy
+	}
+}
+
+// WithBatchSize 设置 redis 版时间轮单次取出任务的数量上限
+func WithBatchSize(size int) ROption {
+	return func(r *RTimeWheel) {
+		if size > 0 {
+			r.batchSize = size
+		}
+	}
+}
+
+// WithMaxCatchUp 设置 redis 版时间轮的最大补偿扫描时长
+// 扫描水位落后于当前时间超过该时长时，更早的时间范围不再扫描
+func WithMaxCatchUp(d time.Duration) ROption {
+	return func(r *RTimeWheel) {
+		if d > 0 {
+			r.maxCatchUp = d
+		}
+	}
+}
+
+// WithPollInterval 设置 redis 版时间轮扫描任务的时间间隔，默认为 1 秒
+func WithPollInterval(interval time.Duration) ROption {
+	return func(r *RTimeWheel) {
+		if interval > 0 {
+			r.pollInterval = interval
+		}
+	}
+}
+
+// WithWorkers 设置 redis 版时间轮在当前实例上并发执行任务的 worker 数量，默认为 100，小于等于 0 时不限制
+// 实例只按照空闲 worker 的数量取出任务，繁忙的实例不再取出任务，从而在多个实例之间均衡负载
+func WithWorkers(n int) ROption {
+	return func(r *RTimeWheel) {
+		if n <= 0 {
+			r.workers = nil
+			return
+		}
+		r.workers = make(chan struct{}, n)
+	}
+}
+
+// WithConsumerID 设置 redis 版时间轮实例的唯一标识，默认由主机名、进程号以及随机数生成
+func WithConsumerID(id string) ROption {
+	return func(r *RTimeWheel) {
+		if id != "" {
+			r.consumerID = id
+		}
+	}
+}
+
+// WithLeaderElection 开启基于 redis 租约的 leader 选举，只有 leader 扫描并执行任务
+// leader 每 ttl/3 续期一次租约，租约过期后由其他实例自动接管
+func WithLeaderElection(ttl time.Duration) ROption {
+	return func(r *RTimeWheel) {
+		r.leaderTTL = ttl
+	}
+}
+
+// WithLeadershipHandler 设置 leader 身份变化时的回调，token 为成为 leader 时获得的 fencing token
+func WithLeadershipHandler(handler func(isLeader bool, token int64)) ROption {
+	return func(r *RTimeWheel) {
+		r.onLeadershipChange = handler
+	}
+}
@@ -0,0 +1,99 @@
+// Package backend 定义分布式时间轮的存储后端接口
+//
+// 任务按照执行时间所属的分钟划分时间片，每个时间片包含待执行任务、已删除任务的 key 以及处理中的任务.
+// 任务明细对存储后端是不透明的，由时间轮负责序列化与反序列化.
+// 处理中的任务在最近一次租约到期 ProcessingTTL 之后仍未确认时，存储后端可以将其清理.
+package backend
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrKeyIndexDisabled 存储后端没有开启 key 索引，无法只通过 key 获取或者删除任务
+var ErrKeyIndexDisabled = errors.New("backend: key index disabled")
+
+// ProcessingTTL 处理中的任务在最近一次租约到期之后的保留时长
+const ProcessingTTL = 24 * time.Hour
+
+// Task 存储后端中的一笔任务
+type Task struct {
+	// 任务 key
+	Key string
+	// 执行时间，精确到毫秒
+	ExecuteAt time.Time
+	// 任务明细，同一时间片内相同的明细只保存一份
+	Body string
+}
+
+// Claimed 从时间片中取出的任务
+type Claimed struct {
+	// 时间片内已删除任务的 key，时间轮据此跳过已删除的任务
+	Deleted []string
+	// 取出的任务明细，包含已删除的任务
+	Bodies []string
+	// 各笔任务被取出的次数，与 Bodies 一一对应
+	Deliveries []int
+}
+
+// Backend 分布式时间轮的存储后端
+// 所有方法都需要是原子的，并且可以被多个时间轮实例并发调用
+type Backend interface {
+	// Add 将任务写入执行时间对应的时间片，同时清除该时间片内 key 的删除标识，并将 key 索引指向该任务
+	// key 索引指向的原任务尚未完成时，将其从待执行以及处理中的任务中移除，同一 key 只保留最近一次写入的任务
+	// 返回是否替换了 key 索引原先指向的任务，没有开启 key 索引时总是返回 false
+	Add(ctx context.Context, task Task) (replaced bool, err error)
+
+	// Replace 仅当 key 索引仍然指向 old 时以 task 替换 old，替换的方式与 Add 一致，old 与 task 的 key 相同
+	// key 索引已不再指向 old 时不做任何修改并返回 false. 没有开启 key 索引时返回 ErrKeyIndexDisabled
+	Replace(ctx context.Context, old, task Task) (bool, error)
+
+	// Remove 在执行时间对应的时间片内标识 key 已删除. 删除标识至少保留到执行时间之后 1 小时
+	// key 索引指向该时间片内的任务时，删除 key 索引并将该任务从待执行的任务中移除
+	Remove(ctx context.Context, key string, executeAt time.Time) error
+
+	// Lookup 通过 key 索引获取 key 最近一次写入并且尚未完成的任务，不存在时返回 nil
+	Lookup(ctx context.Context, key string) (*Task, error)
+
+	// RemoveKey 通过 key 索引删除 key 最近一次写入的任务：将其从待执行的任务中移除，在所属时间片内标识 key 已删除，
+	// 并删除 key 索引. 返回删除的任务，不存在时返回 nil
+	RemoveKey(ctx context.Context, key string) (*Task, error)
+
+	// Claim 按照执行时间先后顺序，从 minute 对应的时间片中取出至多 limit 笔执行时间在 (from, to] 范围内的任务
+	// 取出的任务转入处理中，租约在 leaseDeadline 到期，到期前没有 Ack 的任务可以通过 Reclaim 重新取出. 取出次数记为 1
+	Claim(ctx context.Context, minute, from, to time.Time, limit int, leaseDeadline time.Time) (*Claimed, error)
+
+	// Reclaim 从 minute 对应的时间片中重新取出至多 limit 笔租约在 now 之前到期的任务，并将租约延长到 leaseDeadline
+	// 每次重新取出时任务的取出次数加 1
+	Reclaim(ctx context.Context, minute, now time.Time, limit int, leaseDeadline time.Time) (*Claimed, error)
+
+	// Ack 确认 minute 对应时间片内的任务处理完成，将其从处理中移除. key 索引仍然指向该任务时一并删除
+	// 无法解析出 key 的任务，Task 中只有 Body
+	Ack(ctx context.Context, minute time.Time, tasks ...Task) error
+
+	// Watermark 获取已扫描完成的水位，尚未记录时返回零值
+	Watermark(ctx context.Context) (time.Time, error)
+
+	// AdvanceWatermark 推进已扫描完成的水位，水位只增不减
+	AdvanceWatermark(ctx context.Context, watermark time.Time) error
+
+	// AcquireLeader 竞选或者续期时长为 ttl 的 leader 租约
+	// 返回 id 持有的 fencing token，fencing token 随每次 leader 变更单调递增. 租约被其他实例持有时返回 0
+	AcquireLeader(ctx context.Context, id string, ttl time.Duration) (int64, error)
+
+	// ReleaseLeader 释放 id 持有的 leader 租约，未持有时忽略
+	ReleaseLeader(ctx context.Context, id string) error
+
+	// AddDeadLetter 以失败时间写入死信
+	AddDeadLetter(ctx context.Context, failedAt time.Time, body string) error
+
+	// RangeDeadLetters 按照失败时间先后顺序分页获取死信
+	RangeDeadLetters(ctx context.Context, offset, limit int) ([]string, error)
+
+	// RemoveDeadLetters 删除指定的死信
+	RemoveDeadLetters(ctx context.Context, bodies ...string) error
+
+	// PurgeDeadLetters 清理失败时间不晚于 before 的死信，返回清理的数量
+	PurgeDeadLetters(ctx context.Context, before time.Time) (int, error)
+}
@@ -0,0 +1,703 @@
+// Package backendtest 提供存储后端的一致性测试，各个 backend.Backend 实现都需要通过该测试
+package backendtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dej4vu/timewheel/pkg/backend"
+)
+
+// Factory 为每个测试用例构造一个全新的、不包含任何数据的存储后端
+type Factory func(t *testing.T) backend.Backend
+
+// Run 对存储后端执行一致性测试
+func Run(t *testing.T, factory Factory) {
+	for _, tc := range []struct {
+		name string
+		test func(t *testing.T, b backend.Backend)
+	}{
+		{"ClaimOrder", testClaimOrder},
+		{"ClaimRange", testClaimRange},
+		{"ClaimLimit", testClaimLimit},
+		{"Remove", testRemove},
+		{"RemoveThenAdd", testRemoveThenAdd},
+		{"Ack", testAck},
+		{"KeyIndex", testKeyIndex},
+		{"Replace", testReplace},
+		{"ConcurrentReplace", testConcurrentReplace},
+		{"ConditionalReplace", testConditionalReplace},
+		{"Reclaim", testReclaim},
+		{"Deliveries", testDeliveries},
+		{"Watermark", testWatermark},
+		{"Leader", testLeader},
+		{"DeadLetters", testDeadLetters},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, factory(t))
+		})
+	}
+}
+
+// baseMinute 测试使用的分钟级时间片，位于未来，避免与正在运行的时间轮互相影响
+func baseMinute() time.Time {
+	return time.Now().Add(24 * time.Hour).Truncate(time.Minute)
+}
+
+func body(key string) string {
+	return fmt.Sprintf(`{"key":%q}`, key)
+}
+
+func task(key string, executeAt time.Time) backend.Task {
+	return backend.Task{Key: key, ExecuteAt: executeAt, Body: body(key)}
+}
+
+func add(t *testing.T, b backend.Backend, key string, executeAt time.Time) {
+	t.Helper()
+	if _, err := b.Add(context.Background(), task(key, executeAt)); err != nil {
+		t.Fatalf("add %s: %v", key, err)
+	}
+}
+
+func claim(t *testing.T, b backend.Backend, minute, from, to time.Time, limit int) *backend.Claimed {
+	t.Helper()
+	claimed, err := b.Claim(context.Background(), minute, from, to, limit, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	return claimed
+}
+
+func bodies(keys ...string) []string {
+	bodies := make([]string, 0, len(keys))
+	for _, key := range keys {
+		bodies = append(bodies, body(key))
+	}
+	return bodies
+}
+
+func assertBodies(t *testing.T, got []string, keys ...string) {
+	t.Helper()
+	if want := bodies(keys...); !(len(got) == 0 && len(want) == 0) && !reflect.DeepEqual(got, want) {
+		t.Errorf("bodies = %v, want %v", got, want)
+	}
+}
+
+// testClaimOrder 任务按照执行时间先后顺序取出，精确到毫秒
+func testClaimOrder(t *testing.T, b backend.Backend) {
+	minute := baseMinute()
+	add(t, b, "c", minute.Add(3*time.Second))
+	add(t, b, "a", minute.Add(time.Second))
+	add(t, b, "b", minute.Add(time.Second+time.Millisecond))
+
+	claimed := claim(t, b, minute, minute.Add(-time.Millisecond), minute.Add(time.Minute-time.Millisecond), 10)
+	assertBodies(t, claimed.Bodies, "a", "b", "c")
+	if len(claimed.Deleted) != 0 {
+		t.Errorf("deleted = %v, want empty", claimed.Deleted)
+	}
+
+	// 已取出的任务不会被再次取出
+	claimed = claim(t, b, minute, minute.Add(-time.Millisecond), minute.Add(time.Minute-time.Millisecond), 10)
+	assertBodies(t, claimed.Bodies)
+}
+
+// testClaimRange 只取出执行时间在 (from, to] 范围内的任务
+func testClaimRange(t *testing.T, b backend.Backend) {
+	minute := baseMinute()
+	add(t, b, "a", minute.Add(time.Second))
+	add(t, b, "b", minute.Add(2*time.Second))
+	add(t, b, "c", minute.Add(3*time.Second))
+
+	claimed := claim(t, b, minute, minute.Add(time.Second), minute.Add(2*time.Second), 10)
+	assertBodies(t, claimed.Bodies, "b")
+
+	// 其他时间片中的任务不会被取出
+	claimed = claim(t, b, minute.Add(time.Minute), minute, minute.Add(2*time.Minute), 10)
+	assertBodies(t, claimed.Bodies)
+
+	claimed = claim(t, b, minute, minute, minute.Add(time.Minute), 10)
+	assertBodies(t, claimed.Bodies, "a", "c")
+}
+
+// testClaimLimit 单次最多取出 limit 笔任务
+func testClaimLimit(t *testing.T, b backend.Backend) {
+	minute := baseMinute()
+	for i := 0; i < 5; i++ {
+		add(t, b, fmt.Sprintf("k%d", i), minute.Add(time.Duration(i)*time.Second))
+	}
+
+	from, to := minute.Add(-time.Millisecond), minute.Add(time.Minute)
+	assertBodies(t, claim(t, b, minute, from, to, 2).Bodies, "k0", "k1")
+	assertBodies(t, claim(t, b, minute, from, to, 2).Bodies, "k2", "k3")
+	assertBodies(t, claim(t, b, minute, from, to, 2).Bodies, "k4")
+}
+
+// testRemove 删除标识随取出的任务一并返回，重新添加任务时清除删除标识
+// 维护 key 索引时，删除的任务同时从待执行的任务中移除
+func testRemove(t *testing.T, b backend.Backend) {
+	ctx := context.Background()
+	minute := baseMinute()
+	add(t, b, "a", minute.Add(time.Second))
+	add(t, b, "b", minute.Add(2*time.Second))
+	if err := b.Remove(ctx, "a", minute.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Remove(ctx, "b", minute.Add(2*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	add(t, b, "b", minute.Add(2*time.Second))
+
+	claimed := claim(t, b, minute, minute, minute.Add(time.Minute), 10)
+	if _, err := b.Lookup(ctx, "a"); errors.Is(err, backend.ErrKeyIndexDisabled) {
+		assertBodies(t, claimed.Bodies, "a", "b")
+	} else {
+		assertBodies(t, claimed.Bodies, "b")
+	}
+	if !reflect.DeepEqual(claimed.Deleted, []string{"a"}) {
+		t.Errorf("deleted = %v, want [a]", claimed.Deleted)
+	}
+
+	// 删除标识只作用于执行时间对应的时间片
+	next := minute.Add(time.Minute)
+	add(t, b, "a", next.Add(time.Second))
+	claimed = claim(t, b, next, next, next.Add(time.Minute), 10)
+	assertBodies(t, claimed.Bodies, "a")
+	if len(claimed.Deleted) != 0 {
+		t.Errorf("deleted = %v, want empty", claimed.Deleted)
+	}
+}
+
+// testRemoveThenAdd 指定执行时间删除任务后，在同一时间片内重新添加同一 key 的任务，只取出重新添加的任务
+func testRemoveThenAdd(t *testing.T, b backend.Backend) {
+	ctx := context.Background()
+	minute := baseMinute()
+	if _, err := b.Lookup(ctx, "a"); errors.Is(err, backend.ErrKeyIndexDisabled) {
+		t.Skip("key index disabled")
+	}
+
+	add(t, b, "a", minute.Add(time.Second))
+	if err := b.Remove(ctx, "a", minute.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	// 删除时 key 索引随之清除，再次写入不视为替换
+	if replaced, err := b.Add(ctx, backend.Task{Key: "a", ExecuteAt: minute.Add(2 * time.Second), Body: body("a2")}); err != nil || replaced {
+		t.Fatalf("add after remove = %v, %v, want not replaced", replaced, err)
+	}
+
+	claimed := claim(t, b, minute, minute, minute.Add(time.Minute), 10)
+	assertBodies(t, claimed.Bodies, "a2")
+	if len(claimed.Deleted) != 0 {
+		t.Errorf("deleted = %v, want empty", claimed.Deleted)
+	}
+}
+
+// testAck 确认处理完成的任务不会被回收
+func testAck(t *testing.T, b backend.Backend) {
+	ctx := context.Background()
+	minute := baseMinute()
+	add(t, b, "a", minute.Add(time.Second))
+	add(t, b, "b", minute.Add(2*time.Second))
+
+	// 租约已到期
+	claimed, err := b.Claim(ctx, minute, minute, minute.Add(time.Minute), 10, time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertBodies(t, claimed.Bodies, "a", "b")
+	if err := b.Ack(ctx, minute, task("a", minute.Add(time.Second))); err != nil {
+		t.Fatal(err)
+	}
+
+	reclaimed, err := b.Reclaim(ctx, minute, time.Now(), 10, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertBodies(t, reclaimed.Bodies, "b")
+
+	// 重复 ack 以及 ack 不存在的任务不会报错
+	if err := b.Ack(ctx, minute, task("a", minute.Add(time.Second)), task("b", minute.Add(2*time.Second)), task("c", minute)); err != nil {
+		t.Fatal(err)
+	}
+	reclaimed, err = b.Reclaim(ctx, minute, time.Now().Add(time.Hour), 10, time.Now().Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertBodies(t, reclaimed.Bodies)
+}
+
+// testKeyIndex 通过 key 索引查询以及删除任务，任务被确认或者删除后索引随之清除
+func testKeyIndex(t *testing.T, b backend.Backend) {
+	ctx := context.Background()
+	minute := baseMinute()
+	lookup := func(key string) *backend.Task {
+		t.Helper()
+		got, err := b.Lookup(ctx, key)
+		if errors.Is(err, backend.ErrKeyIndexDisabled) {
+			t.Skip("key index disabled")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	assertTask := func(got *backend.Task, want backend.Task) {
+		t.Helper()
+		if got == nil || got.Key != want.Key || got.Body != want.Body || !got.ExecuteAt.Equal(want.ExecuteAt) {
+			t.Errorf("task = %+v, want %+v", got, want)
+		}
+	}
+
+	if got := lookup("a"); got != nil {
+		t.Errorf("lookup before add = %+v, want nil", got)
+	}
+	add(t, b, "a", minute.Add(time.Second))
+	add(t, b, "b", minute.Add(2*time.Second))
+	add(t, b, "c", minute.Add(3*time.Second))
+	add(t, b, "d", minute.Add(4*time.Second))
+	assertTask(lookup("a"), task("a", minute.Add(time.Second)))
+
+	// 只通过 key 删除待执行的任务
+	removed, err := b.RemoveKey(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertTask(removed, task("a", minute.Add(time.Second)))
+	if got := lookup("a"); got != nil {
+		t.Errorf("lookup after remove = %+v, want nil", got)
+	}
+	if removed, err := b.RemoveKey(ctx, "a"); err != nil || removed != nil {
+		t.Errorf("remove again = %+v, %v, want nil", removed, err)
+	}
+
+	// 指定执行时间删除任务时，同一时间片内的索引一并清除
+	if err := b.Remove(ctx, "b", minute.Add(2*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if got := lookup("b"); got != nil {
+		t.Errorf("lookup after remove with time = %+v, want nil", got)
+	}
+	if err := b.Remove(ctx, "c", minute.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	assertTask(lookup("c"), task("c", minute.Add(3*time.Second)))
+
+	claimed := claim(t, b, minute, minute, minute.Add(time.Minute), 10)
+	assertBodies(t, claimed.Bodies, "c", "d")
+	sort.Strings(claimed.Deleted)
+	if !reflect.DeepEqual(claimed.Deleted, []string{"a", "b"}) {
+		t.Errorf("deleted = %v, want [a b]", claimed.Deleted)
+	}
+
+	// 被取出但未确认的任务仍然可以通过 key 删除，执行时跳过
+	assertTask(lookup("d"), task("d", minute.Add(4*time.Second)))
+	if removed, err := b.RemoveKey(ctx, "d"); err != nil || removed == nil {
+		t.Fatalf("remove claimed = %+v, %v", removed, err)
+	}
+	claimed = claim(t, b, minute, minute, minute.Add(time.Minute), 10)
+	if sort.Strings(claimed.Deleted); !reflect.DeepEqual(claimed.Deleted, []string{"a", "b", "d"}) {
+		t.Errorf("deleted = %v, want [a b d]", claimed.Deleted)
+	}
+
+	// 确认处理完成后清除索引，索引已指向同一 key 的新任务时保留
+	next := backend.Task{Key: "c", ExecuteAt: minute.Add(time.Minute + 3*time.Second), Body: body("c-next")}
+	if _, err := b.Add(ctx, next); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Ack(ctx, minute, task("b", minute.Add(2*time.Second)), task("c", minute.Add(3*time.Second))); err != nil {
+		t.Fatal(err)
+	}
+	assertTask(lookup("c"), next)
+	if err := b.Ack(ctx, next.ExecuteAt.Truncate(time.Minute), next); err != nil {
+		t.Fatal(err)
+	}
+	if got := lookup("c"); got != nil {
+		t.Errorf("lookup after ack = %+v, want nil", got)
+	}
+}
+
+// testReplace 重复写入同一 key 时替换原任务，原任务不论待执行还是处理中都不会再被取出
+func testReplace(t *testing.T, b backend.Backend) {
+	ctx := context.Background()
+	minute := baseMinute()
+	next := minute.Add(time.Minute)
+	if _, err := b.Lookup(ctx, "a"); errors.Is(err, backend.ErrKeyIndexDisabled) {
+		t.Skip("key index disabled")
+	}
+	put := func(key, version string, executeAt time.Time) {
+		t.Helper()
+		replaced, err := b.Add(ctx, backend.Task{Key: key, ExecuteAt: executeAt, Body: body(key + version)})
+		if err != nil {
+			t.Fatalf("add %s%s: %v", key, version, err)
+		}
+		// 首次写入之后的写入均替换原任务
+		if want := version != "1"; replaced != want {
+			t.Errorf("add %s%s replaced = %v, want %v", key, version, replaced, want)
+		}
+	}
+
+	// 跨时间片以及同一时间片内替换待执行的任务
+	put("a", "1", minute.Add(time.Second))
+	put("a", "2", next.Add(time.Second))
+	put("b", "1", minute.Add(time.Second))
+	put("b", "2", minute.Add(5*time.Second))
+	assertBodies(t, claim(t, b, minute, minute, minute.Add(time.Minute), 10).Bodies, "b2")
+	assertBodies(t, claim(t, b, next, next, next.Add(time.Minute), 10).Bodies, "a2")
+
+	// 替换处理中的任务，租约过期后不会被回收
+	put("c", "1", minute.Add(10*time.Second))
+	if _, err := b.Claim(ctx, minute, minute, minute.Add(time.Minute), 10, time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	put("c", "2", minute.Add(20*time.Second))
+	reclaimed, err := b.Reclaim(ctx, minute, time.Now(), 10, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertBodies(t, reclaimed.Bodies)
+	assertBodies(t, claim(t, b, minute, minute, minute.Add(time.Minute), 10).Bodies, "c2")
+
+	got, err := b.Lookup(ctx, "c")
+	if err != nil || got == nil || got.Body != body("c2") {
+		t.Errorf("lookup = %+v, %v, want c2", got, err)
+	}
+}
+
+// testConcurrentReplace 并发写入同一 key 的任务均成功，最终只保留 key 索引指向的一笔任务
+func testConcurrentReplace(t *testing.T, b backend.Backend) {
+	ctx := context.Background()
+	minute := baseMinute()
+	if _, err := b.Lookup(ctx, "a"); errors.Is(err, backend.ErrKeyIndexDisabled) {
+		t.Skip("key index disabled")
+	}
+
+	const n = 10
+	var replaced atomic.Int32
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// 分布在相邻的两个时间片中
+			executeAt := minute.Add(time.Duration(i) * 10 * time.Second)
+			ok, err := b.Add(ctx, backend.Task{Key: "a", ExecuteAt: executeAt, Body: body(fmt.Sprintf("a%d", i))})
+			if ok {
+				replaced.Add(1)
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("add: %v", err)
+		}
+	}
+
+	// 除首次写入之外的写入均替换了原任务
+	if got := replaced.Load(); got != n-1 {
+		t.Errorf("replaced = %d, want %d", got, n-1)
+	}
+
+	got, err := b.Lookup(ctx, "a")
+	if err != nil || got == nil {
+		t.Fatalf("lookup = %+v, %v", got, err)
+	}
+	var claimed []string
+	for _, m := range []time.Time{minute, minute.Add(time.Minute)} {
+		claimed = append(claimed, claim(t, b, m, m.Add(-time.Millisecond), m.Add(time.Minute), n).Bodies...)
+	}
+	if len(claimed) != 1 || claimed[0] != got.Body {
+		t.Errorf("claimed = %v, want [%s]", claimed, got.Body)
+	}
+}
+
+// testConditionalReplace 只有 key 索引仍然指向原任务时才替换，原任务已被替换、确认或者删除时不做任何修改
+func testConditionalReplace(t *testing.T, b backend.Backend) {
+	ctx := context.Background()
+	minute := baseMinute()
+	if _, err := b.Lookup(ctx, "a"); errors.Is(err, backend.ErrKeyIndexDisabled) {
+		if _, err := b.Replace(ctx, task("a", minute), task("a", minute)); !errors.Is(err, backend.ErrKeyIndexDisabled) {
+			t.Errorf("replace err = %v, want ErrKeyIndexDisabled", err)
+		}
+		t.Skip("key index disabled")
+	}
+	replace := func(old, next backend.Task, want bool) {
+		t.Helper()
+		if ok, err := b.Replace(ctx, old, next); err != nil || ok != want {
+			t.Fatalf("replace %s with %s = %v, %v, want %v", old.Body, next.Body, ok, err, want)
+		}
+	}
+	version := func(key, version string, executeAt time.Time) backend.Task {
+		return backend.Task{Key: key, ExecuteAt: executeAt, Body: body(key + version)}
+	}
+
+	// key 索引不存在时不写入
+	replace(version("a", "1", minute.Add(time.Second)), version("a", "2", minute.Add(2*time.Second)), false)
+	if got, err := b.Lookup(ctx, "a"); err != nil || got != nil {
+		t.Fatalf("lookup after failed replace = %+v, %v, want nil", got, err)
+	}
+
+	// 原任务仍然是 key 索引指向的任务时替换，之后以原任务为条件的替换失败
+	a1, a2 := version("a", "1", minute.Add(time.Second)), version("a", "2", minute.Add(2*time.Second))
+	if _, err := b.Add(ctx, a1); err != nil {
+		t.Fatal(err)
+	}
+	replace(a1, a2, true)
+	replace(a1, version("a", "3", minute.Add(3*time.Second)), false)
+	// 执行时间不同的原任务视为不同的任务
+	replace(version("a", "2", minute.Add(3*time.Second)), version("a", "3", minute.Add(3*time.Second)), false)
+	assertBodies(t, claim(t, b, minute, minute, minute.Add(time.Minute), 10).Bodies, "a2")
+
+	// 原任务确认完成后不再写入，避免重新执行已完成的任务
+	if err := b.Ack(ctx, minute, a2); err != nil {
+		t.Fatal(err)
+	}
+	replace(a2, version("a", "4", minute.Add(4*time.Second)), false)
+
+	// 原任务通过 key 删除后不再写入
+	b1 := version("b", "1", minute.Add(5*time.Second))
+	if _, err := b.Add(ctx, b1); err != nil {
+		t.Fatal(err)
+	}
+	if removed, err := b.RemoveKey(ctx, "b"); err != nil || removed == nil {
+		t.Fatalf("remove key = %+v, %v", removed, err)
+	}
+	replace(b1, version("b", "2", minute.Add(6*time.Second)), false)
+
+	claimed := claim(t, b, minute, minute, minute.Add(time.Minute), 10)
+	assertBodies(t, claimed.Bodies)
+	for _, key := range []string{"a", "b"} {
+		if got, err := b.Lookup(ctx, key); err != nil || got != nil {
+			t.Errorf("lookup %s = %+v, %v, want nil", key, got, err)
+		}
+	}
+}
+
+// testReclaim 只回收租约已到期的任务，回收时延长租约
+func testReclaim(t *testing.T, b backend.Backend) {
+	ctx := context.Background()
+	minute := baseMinute()
+	now := time.Now()
+	add(t, b, "a", minute.Add(time.Second))
+	add(t, b, "b", minute.Add(2*time.Second))
+	add(t, b, "c", minute.Add(3*time.Second))
+
+	if _, err := b.Claim(ctx, minute, minute, minute.Add(time.Second), 10, now.Add(-2*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Claim(ctx, minute, minute.Add(time.Second), minute.Add(2*time.Second), 10, now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Claim(ctx, minute, minute.Add(2*time.Second), minute.Add(3*time.Second), 10, now.Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	// 已被取出的任务删除后仍然可以回收，随删除标识一并返回
+	if err := b.Remove(ctx, "c", minute.Add(3*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	reclaimed, err := b.Reclaim(ctx, minute, now, 1, now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertBodies(t, reclaimed.Bodies, "a")
+	if !reflect.DeepEqual(reclaimed.Deleted, []string{"c"}) {
+		t.Errorf("deleted = %v, want [c]", reclaimed.Deleted)
+	}
+
+	reclaimed, err = b.Reclaim(ctx, minute, now, 10, now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertBodies(t, reclaimed.Bodies, "c")
+
+	// 租约已被延长，不会被再次回收
+	reclaimed, err = b.Reclaim(ctx, minute, now, 10, now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertBodies(t, reclaimed.Bodies)
+
+	reclaimed, err = b.Reclaim(ctx, minute, now.Add(time.Minute), 10, now.Add(2*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := append([]string(nil), reclaimed.Bodies...)
+	sort.Strings(got)
+	assertBodies(t, got, "a", "b", "c")
+}
+
+// testDeliveries 首次取出时取出次数为 1，每次回收加 1，ack 之后重新写入的任务重新计数
+func testDeliveries(t *testing.T, b backend.Backend) {
+	ctx := context.Background()
+	minute := baseMinute()
+	now := time.Now()
+	add(t, b, "a", minute.Add(time.Second))
+	add(t, b, "b", minute.Add(2*time.Second))
+
+	claimed, err := b.Claim(ctx, minute, minute, minute.Add(time.Second), 10, now.Add(-2*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertBodies(t, claimed.Bodies, "a")
+	assertDeliveries(t, claimed, 1)
+	if claimed, err = b.Claim(ctx, minute, minute.Add(time.Second), minute.Add(time.Minute), 10, now.Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	assertBodies(t, claimed.Bodies, "b")
+	assertDeliveries(t, claimed, 1)
+
+	// 按照租约到期时间先后顺序回收，a 的租约始终最早到期
+	for i, lease := range []time.Time{now.Add(-3 * time.Second), now.Add(time.Minute)} {
+		reclaimed, err := b.Reclaim(ctx, minute, now, 1, lease)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertBodies(t, reclaimed.Bodies, "a")
+		assertDeliveries(t, reclaimed, i+2)
+	}
+	reclaimed, err := b.Reclaim(ctx, minute, now, 10, now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertBodies(t, reclaimed.Bodies, "b")
+	assertDeliveries(t, reclaimed, 2)
+
+	if err := b.Ack(ctx, minute, task("a", minute.Add(time.Second))); err != nil {
+		t.Fatal(err)
+	}
+	add(t, b, "a", minute.Add(time.Second))
+	claimed = claim(t, b, minute, minute, minute.Add(time.Minute), 10)
+	assertBodies(t, claimed.Bodies, "a")
+	assertDeliveries(t, claimed, 1)
+}
+
+func assertDeliveries(t *testing.T, claimed *backend.Claimed, want ...int) {
+	t.Helper()
+	if !reflect.DeepEqual(claimed.Deliveries, want) {
+		t.Errorf("deliveries = %v, want %v", claimed.Deliveries, want)
+	}
+}
+
+// testWatermark 水位只增不减，精确到毫秒
+func testWatermark(t *testing.T, b backend.Backend) {
+	ctx := context.Background()
+	watermark, err := b.Watermark(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !watermark.IsZero() {
+		t.Errorf("initial watermark = %v, want zero", watermark)
+	}
+
+	want := time.UnixMilli(time.Now().UnixMilli())
+	if err := b.AdvanceWatermark(ctx, want); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AdvanceWatermark(ctx, want.Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if watermark, err = b.Watermark(ctx); err != nil || !watermark.Equal(want) {
+		t.Errorf("watermark = %v, %v, want %v", watermark, err, want)
+	}
+
+	want = want.Add(time.Millisecond)
+	if err := b.AdvanceWatermark(ctx, want); err != nil {
+		t.Fatal(err)
+	}
+	if watermark, err = b.Watermark(ctx); err != nil || !watermark.Equal(want) {
+		t.Errorf("watermark = %v, %v, want %v", watermark, err, want)
+	}
+}
+
+// testLeader leader 租约互斥，fencing token 随 leader 变更单调递增
+func testLeader(t *testing.T, b backend.Backend) {
+	ctx := context.Background()
+	ttl := 500 * time.Millisecond
+
+	acquire := func(id string) int64 {
+		t.Helper()
+		token, err := b.AcquireLeader(ctx, id, ttl)
+		if err != nil {
+			t.Fatalf("acquire %s: %v", id, err)
+		}
+		return token
+	}
+
+	token1 := acquire("a")
+	if token1 <= 0 {
+		t.Fatalf("token = %d, want > 0", token1)
+	}
+	if token := acquire("b"); token != 0 {
+		t.Errorf("b acquired leader held by a, token = %d", token)
+	}
+	// 续期时 fencing token 不变
+	if token := acquire("a"); token != token1 {
+		t.Errorf("renew token = %d, want %d", token, token1)
+	}
+
+	// 非持有者释放租约无效
+	if err := b.ReleaseLeader(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if token := acquire("b"); token != 0 {
+		t.Errorf("b acquired leader held by a, token = %d", token)
+	}
+
+	if err := b.ReleaseLeader(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	token2 := acquire("b")
+	if token2 <= token1 {
+		t.Errorf("token = %d, want > %d", token2, token1)
+	}
+
+	// 租约到期后其他实例可以接管
+	<-time.After(ttl + 200*time.Millisecond)
+	if token3 := acquire("a"); token3 <= token2 {
+		t.Errorf("token = %d, want > %d", token3, token2)
+	}
+}
+
+// testDeadLetters 死信按照失败时间先后顺序分页获取，可以删除以及按照失败时间清理
+func testDeadLetters(t *testing.T, b backend.Backend) {
+	ctx := context.Background()
+	now := time.UnixMilli(time.Now().UnixMilli())
+	for i, key := range []string{"b", "a", "c", "d"} {
+		if err := b.AddDeadLetter(ctx, now.Add(time.Duration(i)*time.Second), body(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadLetters, err := b.RangeDeadLetters(ctx, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertBodies(t, deadLetters, "a", "c")
+
+	if err := b.RemoveDeadLetters(ctx, body("a")); err != nil {
+		t.Fatal(err)
+	}
+	purged, err := b.PurgeDeadLetters(ctx, now.Add(2*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 2 {
+		t.Errorf("purged = %d, want 2", purged)
+	}
+
+	deadLetters, err = b.RangeDeadLetters(ctx, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertBodies(t, deadLetters, "d")
+}
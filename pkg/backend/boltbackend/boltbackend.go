@@ -0,0 +1,594 @@
+// Package boltbackend 实现基于 bbolt 的嵌入式持久化存储后端，适用于不依赖 redis 的单节点部署
+//
+// 数据保存在本地文件中，每次写入都在事务提交时落盘，进程崩溃或者重启后待执行任务、处理中任务以及水位均可恢复.
+// bbolt 以文件锁保证同一时刻只有一个进程打开数据文件，因此只适用于单节点.
+package boltbackend
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/dej4vu/timewheel/pkg/backend"
+	bolt "go.etcd.io/bbolt"
+)
+
+var _ backend.Backend = (*Backend)(nil)
+
+const (
+	// 删除标识在执行时间之后的保留时长，与 redis 实现保持一致
+	deletedTTL = time.Hour
+	// 清理过期删除标识以及处理中任务的时间间隔
+	sweepInterval = time.Minute
+	// 打开数据文件时等待文件锁的默认时长
+	defaultTimeout = time.Second
+)
+
+var (
+	// 待执行的任务. key 为 分钟|执行时间|明细摘要，value 为任务明细
+	tasksBucket = []byte("tasks")
+	// 待执行任务的索引，用于同一时间片内相同明细的去重. key 为 分钟|明细摘要，value 为执行时间
+	taskIndexBucket = []byte("task_index")
+	// 处理中的任务. key 为 分钟|明细摘要，value 为 租约到期时间|任务明细
+	processingBucket = []byte("processing")
+	// 处理中任务被取出的次数. key 与处理中的任务一致，value 为取出次数
+	deliveriesBucket = []byte("deliveries")
+	// key 索引，指向 key 最近一次写入的任务. key 为任务 key，value 为 执行时间|任务明细
+	keyIndexBucket = []byte("key_index")
+	// 已删除任务的 key. key 为 分钟|任务 key，value 为过期时间
+	deletedBucket = []byte("deleted")
+	// 水位以及 leader 租约
+	metaBucket = []byte("meta")
+	// 死信. key 为 失败时间|明细摘要，value 为任务明细
+	deadLettersBucket = []byte("dead_letters")
+	// 死信的索引. key 为明细摘要，value 为失败时间
+	deadLetterIndexBucket = []byte("dead_letter_index")
+
+	watermarkKey      = []byte("watermark")
+	leaderKey         = []byte("leader")
+	leaderExpireAtKey = []byte("leader_expire_at")
+	leaderTokenKey    = []byte("leader_token")
+
+	buckets = [][]byte{
+		tasksBucket, taskIndexBucket, keyIndexBucket, processingBucket, deliveriesBucket, deletedBucket,
+		metaBucket, deadLettersBucket, deadLetterIndexBucket,
+	}
+)
+
+// Backend 基于 bbolt 的存储后端，并发安全
+type Backend struct {
+	db *bolt.DB
+	// 上一次清理过期删除标识以及处理中任务的毫秒级时间戳
+	lastSweep atomic.Int64
+}
+
+// options 打开数据文件的配置
+type options struct {
+	timeout time.Duration
+	noSync  bool
+}
+
+// Option 存储后端的配置项
+type Option func(*options)
+
+// WithTimeout 设置打开数据文件时等待文件锁的时长，默认 1s. 为 0 时一直等待
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithNoSync 提交事务时不调用 fsync. 写入性能更高，但操作系统崩溃时可能丢失最近提交的数据
+func WithNoSync(noSync bool) Option {
+	return func(o *options) {
+		o.noSync = noSync
+	}
+}
+
+// Open 打开或者创建数据文件
+func Open(path string, opts ...Option) (*Backend, error) {
+	o := options{timeout: defaultTimeout}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: o.timeout, NoSync: o.noSync})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		for _, name := range buckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &Backend{db: db}, nil
+}
+
+// Close 关闭数据文件
+func (b *Backend) Close() error {
+	return b.db.Close()
+}
+
+func (b *Backend) Add(ctx context.Context, task backend.Task) (bool, error) {
+	var replaced bool
+	err := b.db.Update(func(tx *bolt.Tx) (err error) {
+		replaced, err = add(tx, task)
+		return err
+	})
+	return replaced, err
+}
+
+func (b *Backend) Replace(ctx context.Context, old, task backend.Task) (bool, error) {
+	var replaced bool
+	err := b.db.Update(func(tx *bolt.Tx) (err error) {
+		v := tx.Bucket(keyIndexBucket).Get([]byte(task.Key))
+		if v == nil || decode(v[:8]) != old.ExecuteAt.UnixMilli() || string(v[8:]) != old.Body {
+			return nil
+		}
+		replaced, err = add(tx, task)
+		return err
+	})
+	return replaced, err
+}
+
+// add 写入任务并将 key 索引指向该任务，返回是否替换了 key 索引原先指向的任务
+func add(tx *bolt.Tx, task backend.Task) (bool, error) {
+	minute := minuteKey(task.ExecuteAt)
+	hash := bodyHash(task.Body)
+	if err := tx.Bucket(deletedBucket).Delete(join(minute, []byte(task.Key))); err != nil {
+		return false, err
+	}
+	replaced, err := replace(tx, task.Key)
+	if err != nil {
+		return false, err
+	}
+
+	// 与 redis 实现一致，时间片内相同的待执行任务只保存一份，重复写入时更新执行时间
+	tasks, index := tx.Bucket(tasksBucket), tx.Bucket(taskIndexBucket)
+	indexKey := join(minute, hash)
+	if executeAt := index.Get(indexKey); executeAt != nil {
+		if err := tasks.Delete(join(minute, executeAt, hash)); err != nil {
+			return false, err
+		}
+	}
+	executeAt := encode(task.ExecuteAt.UnixMilli())
+	if err := index.Put(indexKey, executeAt); err != nil {
+		return false, err
+	}
+	if err := tx.Bucket(keyIndexBucket).Put([]byte(task.Key), join(executeAt, []byte(task.Body))); err != nil {
+		return false, err
+	}
+	return replaced, tasks.Put(join(minute, executeAt, hash), []byte(task.Body))
+}
+
+func (b *Backend) Remove(ctx context.Context, key string, executeAt time.Time) error {
+	b.sweep()
+	return b.db.Update(func(tx *bolt.Tx) error {
+		// key 索引指向该时间片内的任务时一并删除，并将任务从待执行的任务中移除
+		keyIndex := tx.Bucket(keyIndexBucket)
+		if v := keyIndex.Get([]byte(key)); v != nil && bytes.Equal(minuteKey(time.UnixMilli(decode(v[:8]))), minuteKey(executeAt)) {
+			hash := bodyHash(string(v[8:]))
+			if err := keyIndex.Delete([]byte(key)); err != nil {
+				return err
+			}
+			if err := removePending(tx, minuteKey(executeAt), hash); err != nil {
+				return err
+			}
+		}
+		return remove(tx, key, executeAt)
+	})
+}
+
+func (b *Backend) Lookup(ctx context.Context, key string) (*backend.Task, error) {
+	var task *backend.Task
+	err := b.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(keyIndexBucket).Get([]byte(key)); v != nil {
+			task = &backend.Task{Key: key, ExecuteAt: time.UnixMilli(decode(v[:8])), Body: string(v[8:])}
+		}
+		return nil
+	})
+	return task, err
+}
+
+func (b *Backend) RemoveKey(ctx context.Context, key string) (*backend.Task, error) {
+	var task *backend.Task
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		keyIndex := tx.Bucket(keyIndexBucket)
+		v := keyIndex.Get([]byte(key))
+		if v == nil {
+			return nil
+		}
+		task = &backend.Task{Key: key, ExecuteAt: time.UnixMilli(decode(v[:8])), Body: string(v[8:])}
+		if err := keyIndex.Delete([]byte(key)); err != nil {
+			return err
+		}
+
+		// 从待执行的任务中移除，已被取出的任务通过删除标识跳过
+		if err := removePending(tx, minuteKey(task.ExecuteAt), bodyHash(task.Body)); err != nil {
+			return err
+		}
+		return remove(tx, key, task.ExecuteAt)
+	})
+	return task, err
+}
+
+// replace 将 key 索引指向的任务从待执行以及处理中的任务中移除，返回 key 索引是否指向了任务
+func replace(tx *bolt.Tx, key string) (bool, error) {
+	v := tx.Bucket(keyIndexBucket).Get([]byte(key))
+	if v == nil {
+		return false, nil
+	}
+	minute, hash := minuteKey(time.UnixMilli(decode(v[:8]))), bodyHash(string(v[8:]))
+	if err := removePending(tx, minute, hash); err != nil {
+		return false, err
+	}
+	return true, removeProcessing(tx, join(minute, hash))
+}
+
+// removeProcessing 将任务从处理中的任务中移除
+func removeProcessing(tx *bolt.Tx, key []byte) error {
+	if err := tx.Bucket(processingBucket).Delete(key); err != nil {
+		return err
+	}
+	return tx.Bucket(deliveriesBucket).Delete(key)
+}
+
+// removePending 将任务从待执行的任务中移除
+func removePending(tx *bolt.Tx, minute, hash []byte) error {
+	index := tx.Bucket(taskIndexBucket)
+	executeAt := index.Get(join(minute, hash))
+	if executeAt == nil {
+		return nil
+	}
+	if err := tx.Bucket(tasksBucket).Delete(join(minute, executeAt, hash)); err != nil {
+		return err
+	}
+	return index.Delete(join(minute, hash))
+}
+
+// remove 在执行时间对应的时间片内标识 key 已删除
+func remove(tx *bolt.Tx, key string, executeAt time.Time) error {
+	deleted := tx.Bucket(deletedBucket)
+	k := join(minuteKey(executeAt), []byte(key))
+	if deleted.Get(k) != nil {
+		return nil
+	}
+	return deleted.Put(k, encode(executeAt.Add(deletedTTL).UnixMilli()))
+}
+
+func (b *Backend) Claim(ctx context.Context, minute, from, to time.Time, limit int, leaseDeadline time.Time) (*backend.Claimed, error) {
+	b.sweep()
+	m := minuteKey(minute)
+	claimed := &backend.Claimed{}
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		claimed.Deleted = deletedKeys(tx, m)
+
+		type entry struct {
+			key, hash, body []byte
+		}
+		var entries []entry
+		c := tx.Bucket(tasksBucket).Cursor()
+		for k, v := c.Seek(join(m, encode(from.UnixMilli()+1))); k != nil && len(entries) < limit; k, v = c.Next() {
+			if !bytes.HasPrefix(k, m) || decode(k[8:16]) > to.UnixMilli() {
+				break
+			}
+			k = clone(k)
+			entries = append(entries, entry{key: k, hash: k[16:], body: clone(v)})
+		}
+
+		tasks, index, processing := tx.Bucket(tasksBucket), tx.Bucket(taskIndexBucket), tx.Bucket(processingBucket)
+		deliveries := tx.Bucket(deliveriesBucket)
+		for _, e := range entries {
+			claimed.Bodies = append(claimed.Bodies, string(e.body))
+			claimed.Deliveries = append(claimed.Deliveries, 1)
+			if err := processing.Put(join(m, e.hash), join(encode(leaseDeadline.UnixMilli()), e.body)); err != nil {
+				return err
+			}
+			if err := deliveries.Put(join(m, e.hash), encode(1)); err != nil {
+				return err
+			}
+			if err := index.Delete(join(m, e.hash)); err != nil {
+				return err
+			}
+			if err := tasks.Delete(e.key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return claimed, err
+}
+
+func (b *Backend) Reclaim(ctx context.Context, minute, now time.Time, limit int, leaseDeadline time.Time) (*backend.Claimed, error) {
+	m := minuteKey(minute)
+	claimed := &backend.Claimed{}
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		claimed.Deleted = deletedKeys(tx, m)
+
+		type entry struct {
+			key   []byte
+			lease int64
+			body  []byte
+		}
+		var entries []entry
+		processing := tx.Bucket(processingBucket)
+		c := processing.Cursor()
+		for k, v := c.Seek(m); k != nil && bytes.HasPrefix(k, m); k, v = c.Next() {
+			if lease := decode(v[:8]); lease <= now.UnixMilli() {
+				entries = append(entries, entry{key: clone(k), lease: lease, body: clone(v[8:])})
+			}
+		}
+		// 与 redis 实现一致，按照租约到期时间先后顺序回收
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].lease < entries[j].lease })
+		if len(entries) > limit {
+			entries = entries[:limit]
+		}
+
+		deliveries := tx.Bucket(deliveriesBucket)
+		for _, e := range entries {
+			n := decode(deliveries.Get(e.key)) + 1
+			claimed.Bodies = append(claimed.Bodies, string(e.body))
+			claimed.Deliveries = append(claimed.Deliveries, int(n))
+			if err := processing.Put(e.key, join(encode(leaseDeadline.UnixMilli()), e.body)); err != nil {
+				return err
+			}
+			if err := deliveries.Put(e.key, encode(n)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return claimed, err
+}
+
+func (b *Backend) Ack(ctx context.Context, minute time.Time, tasks ...backend.Task) error {
+	m := minuteKey(minute)
+	return b.db.Update(func(tx *bolt.Tx) error {
+		keyIndex := tx.Bucket(keyIndexBucket)
+		for _, task := range tasks {
+			if err := removeProcessing(tx, join(m, bodyHash(task.Body))); err != nil {
+				return err
+			}
+			// key 索引仍然指向该任务时一并删除
+			if task.Key == "" {
+				continue
+			}
+			if v := keyIndex.Get([]byte(task.Key)); v != nil && string(v[8:]) == task.Body {
+				if err := keyIndex.Delete([]byte(task.Key)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (b *Backend) Watermark(ctx context.Context) (time.Time, error) {
+	var watermark time.Time
+	err := b.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(metaBucket).Get(watermarkKey); v != nil {
+			watermark = time.UnixMilli(decode(v))
+		}
+		return nil
+	})
+	return watermark, err
+}
+
+func (b *Backend) AdvanceWatermark(ctx context.Context, watermark time.Time) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(metaBucket)
+		if v := meta.Get(watermarkKey); v != nil && decode(v) >= watermark.UnixMilli() {
+			return nil
+		}
+		return meta.Put(watermarkKey, encode(watermark.UnixMilli()))
+	})
+}
+
+func (b *Backend) AcquireLeader(ctx context.Context, id string, ttl time.Duration) (int64, error) {
+	var token int64
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(metaBucket)
+		now := time.Now()
+		leader := string(meta.Get(leaderKey))
+		if v := meta.Get(leaderTokenKey); v != nil {
+			token = decode(v)
+		}
+		if leader != "" && now.UnixMilli() < decode(meta.Get(leaderExpireAtKey)) {
+			if leader != id {
+				token = 0
+				return nil
+			}
+			return meta.Put(leaderExpireAtKey, encode(now.Add(ttl).UnixMilli()))
+		}
+
+		token++
+		if err := meta.Put(leaderKey, []byte(id)); err != nil {
+			return err
+		}
+		if err := meta.Put(leaderExpireAtKey, encode(now.Add(ttl).UnixMilli())); err != nil {
+			return err
+		}
+		return meta.Put(leaderTokenKey, encode(token))
+	})
+	return token, err
+}
+
+func (b *Backend) ReleaseLeader(ctx context.Context, id string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(metaBucket)
+		if string(meta.Get(leaderKey)) != id {
+			return nil
+		}
+		return meta.Delete(leaderKey)
+	})
+}
+
+func (b *Backend) AddDeadLetter(ctx context.Context, failedAt time.Time, body string) error {
+	hash := bodyHash(body)
+	return b.db.Update(func(tx *bolt.Tx) error {
+		deadLetters, index := tx.Bucket(deadLettersBucket), tx.Bucket(deadLetterIndexBucket)
+		if v := index.Get(hash); v != nil {
+			if err := deadLetters.Delete(join(v, hash)); err != nil {
+				return err
+			}
+		}
+		at := encode(failedAt.UnixMilli())
+		if err := index.Put(hash, at); err != nil {
+			return err
+		}
+		return deadLetters.Put(join(at, hash), []byte(body))
+	})
+}
+
+func (b *Backend) RangeDeadLetters(ctx context.Context, offset, limit int) ([]string, error) {
+	var bodies []string
+	err := b.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(deadLettersBucket).Cursor()
+		i := 0
+		for k, v := c.First(); k != nil && len(bodies) < limit; k, v = c.Next() {
+			if i++; i > offset {
+				bodies = append(bodies, string(v))
+			}
+		}
+		return nil
+	})
+	return bodies, err
+}
+
+func (b *Backend) RemoveDeadLetters(ctx context.Context, bodies ...string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		deadLetters, index := tx.Bucket(deadLettersBucket), tx.Bucket(deadLetterIndexBucket)
+		for _, body := range bodies {
+			hash := bodyHash(body)
+			v := index.Get(hash)
+			if v == nil {
+				continue
+			}
+			if err := deadLetters.Delete(join(v, hash)); err != nil {
+				return err
+			}
+			if err := index.Delete(hash); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *Backend) PurgeDeadLetters(ctx context.Context, before time.Time) (int, error) {
+	var purged int
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		deadLetters, index := tx.Bucket(deadLettersBucket), tx.Bucket(deadLetterIndexBucket)
+		var keys [][]byte
+		c := deadLetters.Cursor()
+		for k, _ := c.First(); k != nil && decode(k[:8]) <= before.UnixMilli(); k, _ = c.Next() {
+			keys = append(keys, clone(k))
+		}
+		for _, k := range keys {
+			if err := deadLetters.Delete(k); err != nil {
+				return err
+			}
+			if err := index.Delete(k[8:]); err != nil {
+				return err
+			}
+		}
+		purged = len(keys)
+		return nil
+	})
+	return purged, err
+}
+
+// sweep 定期清理过期的删除标识，以及最近一次租约到期 backend.ProcessingTTL 之后仍未确认的任务，清理失败时等待下一次清理
+func (b *Backend) sweep() {
+	now := time.Now().UnixMilli()
+	last := b.lastSweep.Load()
+	if now-last < sweepInterval.Milliseconds() || !b.lastSweep.CompareAndSwap(last, now) {
+		return
+	}
+
+	_ = b.db.Update(func(tx *bolt.Tx) error {
+		deleted := tx.Bucket(deletedBucket)
+		var keys [][]byte
+		_ = deleted.ForEach(func(k, v []byte) error {
+			if decode(v) <= now {
+				keys = append(keys, clone(k))
+			}
+			return nil
+		})
+		for _, k := range keys {
+			if err := deleted.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		expired := now - backend.ProcessingTTL.Milliseconds()
+		keys = keys[:0]
+		_ = tx.Bucket(processingBucket).ForEach(func(k, v []byte) error {
+			if decode(v[:8]) <= expired {
+				keys = append(keys, clone(k))
+			}
+			return nil
+		})
+		for _, k := range keys {
+			if err := removeProcessing(tx, k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// deletedKeys 获取时间片内未过期的删除标识
+func deletedKeys(tx *bolt.Tx, minute []byte) []string {
+	var keys []string
+	now := time.Now().UnixMilli()
+	c := tx.Bucket(deletedBucket).Cursor()
+	for k, v := c.Seek(minute); k != nil && bytes.HasPrefix(k, minute); k, v = c.Next() {
+		if decode(v) > now {
+			keys = append(keys, string(k[8:]))
+		}
+	}
+	return keys
+}
+
+// bodyHash 任务明细的摘要，用于索引以及去重
+func bodyHash(body string) []byte {
+	sum := sha1.Sum([]byte(body))
+	return sum[:]
+}
+
+// minuteKey 时间所属分钟的毫秒级时间戳，作为时间片在 key 中的前缀
+func minuteKey(t time.Time) []byte {
+	return encode(t.Truncate(time.Minute).UnixMilli())
+}
+
+// encode 以大端序编码时间戳，保证 key 的字节序与时间先后顺序一致
+func encode(v int64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(v))
+	return buf
+}
+
+func decode(b []byte) int64 {
+	return int64(binary.BigEndian.Uint64(b))
+}
+
+// clone 复制 bbolt 返回的字节切片，其只在事务内有效并且在修改数据后可能失效
+func clone(b []byte) []byte {
+	return append([]byte(nil), b...)
+}
+
+// join 拼接 key 的各个部分
+func join(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
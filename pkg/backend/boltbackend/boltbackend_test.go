@@ -0,0 +1,196 @@
+package boltbackend_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dej4vu/timewheel"
+	"github.com/dej4vu/timewheel/pkg/backend"
+	"github.com/dej4vu/timewheel/pkg/backend/backendtest"
+	"github.com/dej4vu/timewheel/pkg/backend/boltbackend"
+)
+
+// 崩溃恢复测试中子进程使用的环境变量，指定数据文件路径
+const boltCrashEnv = "TIMEWHEEL_BOLT_CRASH_PATH"
+
+func openTestBoltBackend(t *testing.T, path string) *boltbackend.Backend {
+	b, err := boltbackend.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = b.Close() })
+	return b
+}
+
+func Test_Backend_Bolt(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) backend.Backend {
+		return openTestBoltBackend(t, filepath.Join(t.TempDir(), "timewheel.db"))
+	})
+}
+
+func Test_BoltBackend_Reopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "timewheel.db")
+	minute := time.Now().Add(time.Hour).Truncate(time.Minute)
+	watermark := time.UnixMilli(time.Now().UnixMilli())
+
+	b, err := boltbackend.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, key := range []string{"a", "b", "c"} {
+		if _, err := b.Add(ctx, backend.Task{Key: key, ExecuteAt: minute.Add(time.Duration(i) * time.Second), Body: key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Remove(ctx, "c", minute.Add(2*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Claim(ctx, minute, minute.Add(-time.Millisecond), minute, 10, time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AdvanceWatermark(ctx, watermark); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新打开后数据完整
+	b = openTestBoltBackend(t, path)
+	if got, err := b.Watermark(ctx); err != nil || !got.Equal(watermark) {
+		t.Fatalf("watermark = %v, %v, want %v", got, err, watermark)
+	}
+	reclaimed, err := b.Reclaim(ctx, minute, time.Now(), 10, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reclaimed.Bodies, []string{"a"}) {
+		t.Fatalf("reclaimed = %v, want [a]", reclaimed.Bodies)
+	}
+	claimed, err := b.Claim(ctx, minute, minute, minute.Add(time.Minute), 10, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 删除的任务已从待执行的任务中移除，删除标识仍然保留
+	if !reflect.DeepEqual(claimed.Bodies, []string{"b"}) || !reflect.DeepEqual(claimed.Deleted, []string{"c"}) {
+		t.Fatalf("claimed = %v, deleted = %v, want [b], [c]", claimed.Bodies, claimed.Deleted)
+	}
+}
+
+func Test_RTimeWheel_BoltBackend(t *testing.T) {
+	ctx := context.Background()
+	var (
+		mu       sync.Mutex
+		executed = make(map[string]int)
+	)
+	rTimeWheel := timewheel.NewRTimeWheelWithBackend(openTestBoltBackend(t, filepath.Join(t.TempDir(), "timewheel.db")), func(ctx context.Context, task *timewheel.RTaskElement) error {
+		mu.Lock()
+		executed[task.Key]++
+		mu.Unlock()
+		return nil
+	}, timewheel.WithPollInterval(100*time.Millisecond))
+	defer rTimeWheel.Stop()
+
+	executeAt := time.Now().Add(time.Second)
+	for _, key := range []string{"test1", "test2", "test3"} {
+		if err := rTimeWheel.AddTask(ctx, key, &timewheel.RTaskElement{Msg: key, Type: "test"}, executeAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 通过 key 索引删除、替换以及调整任务
+	if err := rTimeWheel.RemoveTask(ctx, "test2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rTimeWheel.AddTask(ctx, "test3", &timewheel.RTaskElement{Msg: "test3-2", Type: "test"}, executeAt); err != nil {
+		t.Fatal(err)
+	}
+	if err := rTimeWheel.Reschedule(ctx, "test1", executeAt.Add(500*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+
+	<-time.After(2500 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if want := map[string]int{"test1": 1, "test3": 1}; !reflect.DeepEqual(executed, want) {
+		t.Errorf("executed = %v, want %v", executed, want)
+	}
+	if _, err := rTimeWheel.GetTask(ctx, "test1"); !errors.Is(err, timewheel.ErrTaskNotFound) {
+		t.Errorf("get executed task err = %v, want ErrTaskNotFound", err)
+	}
+}
+
+// Test_BoltBackend_CrashChild 崩溃恢复测试的子进程，取出任务后在执行过程中异常退出
+func Test_BoltBackend_CrashChild(t *testing.T) {
+	path := os.Getenv(boltCrashEnv)
+	if path == "" {
+		t.Skip("run by Test_BoltBackend_CrashRecovery")
+	}
+
+	b, err := boltbackend.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rTimeWheel := timewheel.NewRTimeWheelWithBackend(b, func(ctx context.Context, task *timewheel.RTaskElement) error {
+		// 模拟进程崩溃，不关闭数据文件也不确认任务
+		os.Exit(3)
+		return nil
+	}, timewheel.WithPollInterval(100*time.Millisecond), timewheel.WithVisibilityTimeout(time.Second))
+
+	ctx := context.Background()
+	executeAt := time.Now().Add(500 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		key := fmt.Sprintf("test%d", i)
+		if err := rTimeWheel.AddTask(ctx, key, &timewheel.RTaskElement{Msg: key, Type: "test"}, executeAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rTimeWheel.RemoveTask(ctx, "test1", executeAt); err != nil {
+		t.Fatal(err)
+	}
+	// 未来的任务不会被取出
+	if err := rTimeWheel.AddTask(ctx, "later", &timewheel.RTaskElement{Msg: "later", Type: "test"}, time.Now().Add(3*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	<-time.After(5 * time.Second)
+	t.Fatal("handler was not invoked")
+}
+
+func Test_BoltBackend_CrashRecovery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timewheel.db")
+	cmd := exec.Command(os.Args[0], "-test.run=^Test_BoltBackend_CrashChild$")
+	cmd.Env = append(os.Environ(), boltCrashEnv+"="+path)
+	out, err := cmd.CombinedOutput()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 3 {
+		t.Fatalf("child exited with %v, want exit status 3\n%s", err, out)
+	}
+
+	var (
+		mu       sync.Mutex
+		executed = make(map[string]int)
+	)
+	rTimeWheel := timewheel.NewRTimeWheelWithBackend(openTestBoltBackend(t, path), func(ctx context.Context, task *timewheel.RTaskElement) error {
+		mu.Lock()
+		executed[task.Key]++
+		mu.Unlock()
+		return nil
+	}, timewheel.WithPollInterval(100*time.Millisecond), timewheel.WithVisibilityTimeout(time.Second))
+	defer rTimeWheel.Stop()
+
+	// 崩溃时处理中的任务在租约到期后被回收，未取出的任务正常执行，已删除的任务不执行
+	<-time.After(4 * time.Second)
+	mu.Lock()
+	defer mu.Unlock()
+	if want := map[string]int{"test0": 1, "test2": 1, "later": 1}; !reflect.DeepEqual(executed, want) {
+		t.Errorf("executed = %v, want %v", executed, want)
+	}
+}
@@ -0,0 +1,16 @@
+module github.com/dej4vu/timewheel/pkg/backend/boltbackend
+
+go 1.23.0
+
+require (
+	github.com/dej4vu/timewheel v0.0.0-00010101000000-000000000000
+	go.etcd.io/bbolt v1.4.3
+)
+
+require (
+	github.com/demdxx/gocast v1.2.0 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	golang.org/x/sys v0.29.0 // indirect
+)
+
+replace github.com/dej4vu/timewheel => ../../..
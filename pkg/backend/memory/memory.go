@@ -0,0 +1,367 @@
+// Package memory 实现基于内存的分布式时间轮存储后端，适用于单进程部署以及测试
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dej4vu/timewheel/internal/zset"
+	"github.com/dej4vu/timewheel/pkg/backend"
+)
+
+var _ backend.Backend = (*Backend)(nil)
+
+const (
+	// 删除标识在执行时间之后的保留时长，与 redis 实现保持一致
+	deletedTTL = time.Hour
+	// 清理过期删除标识的时间间隔
+	sweepInterval = time.Minute
+)
+
+// slice 分钟级时间片
+type slice struct {
+	// 待执行的任务，以执行时间的毫秒级时间戳作为 score
+	tasks *zset.Set
+	// 处理中的任务，以租约到期时间的毫秒级时间戳作为 score
+	processing *zset.Set
+	// 处理中的任务被取出的次数
+	deliveries map[string]int
+	// 处理中任务的过期时间，为最近一次租约到期之后 backend.ProcessingTTL
+	processingExpireAt time.Time
+	// 已删除任务的 key
+	deleted map[string]struct{}
+	// 删除标识的过期时间
+	deletedExpireAt time.Time
+}
+
+// empty 时间片中是否已不存在任何数据
+func (s *slice) empty() bool {
+	return s.tasks.Len() == 0 && s.processing.Len() == 0 && len(s.deleted) == 0
+}
+
+// Backend 基于内存的存储后端，并发安全
+type Backend struct {
+	mu sync.Mutex
+	// 分钟级时间片，以所属分钟的毫秒级时间戳作为 key
+	slices map[int64]*slice
+	// 已扫描完成的水位
+	watermark time.Time
+	// leader 租约的持有者、到期时间以及 fencing token
+	leader         string
+	leaderExpireAt time.Time
+	leaderToken    int64
+	// 死信，以失败时间的毫秒级时间戳作为 score
+	deadLetters *zset.Set
+	// key 索引，指向 key 最近一次写入的任务
+	index map[string]backend.Task
+	// 上一次清理过期删除标识的时间
+	lastSweep time.Time
+}
+
+// New 构造基于内存的存储后端
+func New() *Backend {
+	return &Backend{
+		slices:      make(map[int64]*slice),
+		deadLetters: zset.New(),
+		index:       make(map[string]backend.Task),
+	}
+}
+
+func (b *Backend) Add(ctx context.Context, task backend.Task) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.add(task), nil
+}
+
+func (b *Backend) Replace(ctx context.Context, old, task backend.Task) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	current, ok := b.index[task.Key]
+	if !ok || current.ExecuteAt.UnixMilli() != old.ExecuteAt.UnixMilli() || current.Body != old.Body {
+		return false, nil
+	}
+	b.add(task)
+	return true, nil
+}
+
+// add 写入任务并替换 key 最近一次写入的任务，返回是否替换了原任务
+func (b *Backend) add(task backend.Task) bool {
+	old, replaced := b.index[task.Key]
+	if replaced {
+		if s := b.slice(old.ExecuteAt, false); s != nil {
+			s.tasks.Rem(old.Body)
+			s.processing.Rem(old.Body)
+			delete(s.deliveries, old.Body)
+		}
+	}
+
+	s := b.slice(task.ExecuteAt, true)
+	delete(s.deleted, task.Key)
+	s.tasks.Add(task.Body, float64(task.ExecuteAt.UnixMilli()))
+	b.index[task.Key] = task
+	return replaced
+}
+
+func (b *Backend) Remove(ctx context.Context, key string, executeAt time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.remove(key, executeAt)
+	if task, ok := b.index[key]; ok && minuteKey(task.ExecuteAt) == minuteKey(executeAt) {
+		delete(b.index, key)
+		b.slice(executeAt, true).tasks.Rem(task.Body)
+	}
+	return nil
+}
+
+// remove 在执行时间对应的时间片内标识 key 已删除
+func (b *Backend) remove(key string, executeAt time.Time) {
+	s := b.slice(executeAt, true)
+	// 与 redis 实现一致，仅在首次写入删除标识时设置过期时间
+	if len(s.deleted) == 0 {
+		s.deletedExpireAt = executeAt.Add(deletedTTL)
+	}
+	s.deleted[key] = struct{}{}
+}
+
+func (b *Backend) Lookup(ctx context.Context, key string) (*backend.Task, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	task, ok := b.index[key]
+	if !ok {
+		return nil, nil
+	}
+	return &task, nil
+}
+
+func (b *Backend) RemoveKey(ctx context.Context, key string) (*backend.Task, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	task, ok := b.index[key]
+	if !ok {
+		return nil, nil
+	}
+	delete(b.index, key)
+	b.remove(key, task.ExecuteAt)
+	b.slice(task.ExecuteAt, true).tasks.Rem(task.Body)
+	return &task, nil
+}
+
+func (b *Backend) Claim(ctx context.Context, minute, from, to time.Time, limit int, leaseDeadline time.Time) (*backend.Claimed, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := b.slice(minute, false)
+	if s == nil {
+		return &backend.Claimed{}, nil
+	}
+
+	claimed := &backend.Claimed{Deleted: deletedKeys(s)}
+	for _, m := range s.tasks.RangeByScore(
+		zset.Exclusive(float64(from.UnixMilli())), zset.Inclusive(float64(to.UnixMilli())), 0, limit) {
+		s.tasks.Rem(m.Name)
+		s.processing.Add(m.Name, float64(leaseDeadline.UnixMilli()))
+		s.deliveries[m.Name] = 1
+		claimed.Bodies = append(claimed.Bodies, m.Name)
+		claimed.Deliveries = append(claimed.Deliveries, 1)
+	}
+	if len(claimed.Bodies) > 0 {
+		s.expireProcessing(leaseDeadline)
+	}
+	return claimed, nil
+}
+
+func (b *Backend) Reclaim(ctx context.Context, minute, now time.Time, limit int, leaseDeadline time.Time) (*backend.Claimed, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := b.slice(minute, false)
+	if s == nil {
+		return &backend.Claimed{}, nil
+	}
+
+	claimed := &backend.Claimed{Deleted: deletedKeys(s)}
+	for _, m := range s.processing.RangeByScore(zset.NegInf, zset.Inclusive(float64(now.UnixMilli())), 0, limit) {
+		s.processing.Add(m.Name, float64(leaseDeadline.UnixMilli()))
+		s.deliveries[m.Name]++
+		claimed.Bodies = append(claimed.Bodies, m.Name)
+		claimed.Deliveries = append(claimed.Deliveries, s.deliveries[m.Name])
+	}
+	if len(claimed.Bodies) > 0 {
+		s.expireProcessing(leaseDeadline)
+	}
+	return claimed, nil
+}
+
+func (b *Backend) Ack(ctx context.Context, minute time.Time, tasks ...backend.Task) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, task := range tasks {
+		if indexed, ok := b.index[task.Key]; ok && indexed.Body == task.Body {
+			delete(b.index, task.Key)
+		}
+	}
+
+	s := b.slice(minute, false)
+	if s == nil {
+		return nil
+	}
+	for _, task := range tasks {
+		s.processing.Rem(task.Body)
+		delete(s.deliveries, task.Body)
+	}
+	if s.empty() {
+		delete(b.slices, minuteKey(minute))
+	}
+	return nil
+}
+
+func (b *Backend) Watermark(ctx context.Context) (time.Time, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.watermark, nil
+}
+
+func (b *Backend) AdvanceWatermark(ctx context.Context, watermark time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if watermark.After(b.watermark) {
+		b.watermark = watermark
+	}
+	return nil
+}
+
+func (b *Backend) AcquireLeader(ctx context.Context, id string, ttl time.Duration) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	if b.leader != "" && now.Before(b.leaderExpireAt) {
+		if b.leader != id {
+			return 0, nil
+		}
+		b.leaderExpireAt = now.Add(ttl)
+		return b.leaderToken, nil
+	}
+
+	b.leader = id
+	b.leaderExpireAt = now.Add(ttl)
+	b.leaderToken++
+	return b.leaderToken, nil
+}
+
+func (b *Backend) ReleaseLeader(ctx context.Context, id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.leader == id {
+		b.leader = ""
+	}
+	return nil
+}
+
+func (b *Backend) AddDeadLetter(ctx context.Context, failedAt time.Time, body string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.deadLetters.Add(body, float64(failedAt.UnixMilli()))
+	return nil
+}
+
+func (b *Backend) RangeDeadLetters(ctx context.Context, offset, limit int) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var bodies []string
+	for _, m := range b.deadLetters.Range(offset, offset+limit-1) {
+		bodies = append(bodies, m.Name)
+	}
+	return bodies, nil
+}
+
+func (b *Backend) RemoveDeadLetters(ctx context.Context, bodies ...string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, body := range bodies {
+		b.deadLetters.Rem(body)
+	}
+	return nil
+}
+
+func (b *Backend) PurgeDeadLetters(ctx context.Context, before time.Time) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.deadLetters.RemRangeByScore(zset.NegInf, zset.Inclusive(float64(before.UnixMilli()))), nil
+}
+
+// slice 获取时间对应的分钟级时间片，create 为 true 时不存在则创建
+// 获取时惰性清理过期的删除标识以及处理中的任务
+func (b *Backend) slice(t time.Time, create bool) *slice {
+	b.sweep()
+
+	key := minuteKey(t)
+	s, ok := b.slices[key]
+	if ok {
+		s.expire(time.Now())
+	}
+	if !ok && create {
+		s = &slice{
+			tasks:      zset.New(),
+			processing: zset.New(),
+			deliveries: make(map[string]int),
+			deleted:    make(map[string]struct{}),
+		}
+		b.slices[key] = s
+	}
+	return s
+}
+
+// sweep 定期清理过期的删除标识、处理中的任务以及空的时间片
+func (b *Backend) sweep() {
+	now := time.Now()
+	if now.Sub(b.lastSweep) < sweepInterval {
+		return
+	}
+	b.lastSweep = now
+
+	for key, s := range b.slices {
+		s.expire(now)
+		if s.empty() {
+			delete(b.slices, key)
+		}
+	}
+}
+
+// expire 清理时间片内过期的删除标识以及处理中的任务
+func (s *slice) expire(now time.Time) {
+	if len(s.deleted) > 0 && !now.Before(s.deletedExpireAt) {
+		s.deleted = make(map[string]struct{})
+	}
+	if s.processing.Len() > 0 && !now.Before(s.processingExpireAt) {
+		s.processing = zset.New()
+		s.deliveries = make(map[string]int)
+	}
+}
+
+// expireProcessing 与 redis 实现一致，处理中的任务在最近一次租约到期 backend.ProcessingTTL 之后过期
+func (s *slice) expireProcessing(leaseDeadline time.Time) {
+	if expireAt := leaseDeadline.Add(backend.ProcessingTTL); expireAt.After(s.processingExpireAt) {
+		s.processingExpireAt = expireAt
+	}
+}
+
+func deletedKeys(s *slice) []string {
+	keys := make([]string, 0, len(s.deleted))
+	for key := range s.deleted {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func minuteKey(t time.Time) int64 {
+	return t.Truncate(time.Minute).UnixMilli()
+}
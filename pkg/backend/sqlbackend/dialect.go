@@ -0,0 +1,103 @@
+package sqlbackend
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dialect 数据库方言，屏蔽不同数据库在占位符、建表语句以及行锁上的差异
+type Dialect struct {
+	// 方言名称
+	Name string
+	// 是否支持 SELECT ... FOR UPDATE SKIP LOCKED
+	SkipLocked bool
+	// 占位符是否为 $1、$2 形式，否则为 ?
+	numberedPlaceholder bool
+	// 自增主键列的定义
+	autoIncrementPK string
+	// 文本列的类型
+	textType string
+	// 建立索引的语句是否支持 IF NOT EXISTS
+	indexIfNotExists bool
+	// 主键冲突时忽略插入的语句格式，参数依次为表名、列名、占位符
+	insertIgnore string
+	// 主键冲突时保持原值并锁定已存在行的插入语句格式，参数依次为表名、列名、占位符、主键列、更新的列
+	insertLock string
+}
+
+var (
+	// Postgres PostgreSQL 9.5 及以上版本
+	Postgres = &Dialect{
+		Name:                "postgres",
+		SkipLocked:          true,
+		numberedPlaceholder: true,
+		autoIncrementPK:     "BIGSERIAL PRIMARY KEY",
+		textType:            "TEXT",
+		indexIfNotExists:    true,
+		insertIgnore:        "INSERT INTO %s (%s) VALUES (%s) ON CONFLICT DO NOTHING",
+		insertLock:          "INSERT INTO %[1]s (%[2]s) VALUES (%[3]s) ON CONFLICT (%[4]s) DO UPDATE SET %[5]s = %[1]s.%[5]s",
+	}
+
+	// MySQL MySQL 8.0 及以上版本. 低于 8.0 的版本不支持 SKIP LOCKED，需要通过 WithSkipLocked(false) 关闭
+	MySQL = &Dialect{
+		Name:            "mysql",
+		SkipLocked:      true,
+		autoIncrementPK: "BIGINT AUTO_INCREMENT PRIMARY KEY",
+		textType:        "LONGTEXT",
+		insertIgnore:    "INSERT IGNORE INTO %s (%s) VALUES (%s)",
+		insertLock:      "INSERT INTO %[1]s (%[2]s) VALUES (%[3]s) ON DUPLICATE KEY UPDATE %[5]s = %[5]s",
+	}
+
+	// SQLite SQLite 3.24 及以上版本. SQLite 以库级别加锁，不支持 SKIP LOCKED，通过乐观更新取出任务
+	SQLite = &Dialect{
+		Name:             "sqlite",
+		autoIncrementPK:  "INTEGER PRIMARY KEY AUTOINCREMENT",
+		textType:         "TEXT",
+		indexIfNotExists: true,
+		insertIgnore:     "INSERT INTO %s (%s) VALUES (%s) ON CONFLICT DO NOTHING",
+		insertLock:       "INSERT INTO %[1]s (%[2]s) VALUES (%[3]s) ON CONFLICT (%[4]s) DO UPDATE SET %[5]s = %[1]s.%[5]s",
+	}
+)
+
+// rebind 将 ? 占位符转换为方言对应的占位符
+func (d *Dialect) rebind(query string) string {
+	if !d.numberedPlaceholder {
+		return query
+	}
+
+	var sb strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			fmt.Fprintf(&sb, "$%d", n)
+			continue
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+// placeholders 生成 n 个以逗号分隔的 ? 占位符
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+// insertIgnoreQuery 主键冲突时忽略插入的语句
+func (d *Dialect) insertIgnoreQuery(table string, columns ...string) string {
+	return fmt.Sprintf(d.insertIgnore, table, strings.Join(columns, ", "), placeholders(len(columns)))
+}
+
+// insertLockQuery 插入一行，主键 pk 冲突时不修改已存在的行，但与更新一样对其加行锁
+// 行不存在时并发插入同一主键的事务同样串行执行，不会因主键冲突报错
+func (d *Dialect) insertLockQuery(table, pk, column string, columns ...string) string {
+	return fmt.Sprintf(d.insertLock, table, strings.Join(columns, ", "), placeholders(len(columns)), pk, column)
+}
+
+// createIndex 建立索引的语句. 不支持 IF NOT EXISTS 的数据库依赖迁移版本保证只执行一次
+func (d *Dialect) createIndex(name, table, columns string) string {
+	if d.indexIfNotExists {
+		return fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)", name, table, columns)
+	}
+	return fmt.Sprintf("CREATE INDEX %s ON %s (%s)", name, table, columns)
+}
@@ -0,0 +1,18 @@
+module github.com/dej4vu/timewheel/pkg/backend/sqlbackend
+
+go 1.23.0
+
+require (
+	github.com/dej4vu/timewheel v0.0.0-00010101000000-000000000000
+	github.com/go-sql-driver/mysql v1.9.3
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.33
+)
+
+require (
+	filippo.io/edwards25519 v1.1.0 // indirect
+	github.com/demdxx/gocast v1.2.0 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+)
+
+replace github.com/dej4vu/timewheel => ../../..
@@ -0,0 +1,160 @@
+package sqlbackend
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// migration 一个版本的表结构变更
+type migration struct {
+	version int
+	stmts   func(b *Backend) []string
+}
+
+// migrations 按照版本先后顺序排列的表结构变更，已发布的版本不可修改
+var migrations = []migration{
+	{version: 1, stmts: initialSchema},
+	{version: 2, stmts: taskIndexSchema},
+}
+
+// initialSchema 初始表结构
+func initialSchema(b *Backend) []string {
+	d := b.dialect
+	return []string{
+		// 任务，按照所属分钟以及执行时间建立索引. status 为 0 时待执行，为 1 时处理中，deliveries 为被取出的次数
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id %s,
+	minute BIGINT NOT NULL,
+	task_key %s NOT NULL,
+	body %s NOT NULL,
+	body_hash CHAR(40) NOT NULL,
+	execute_at BIGINT NOT NULL,
+	status SMALLINT NOT NULL DEFAULT 0,
+	lease_deadline BIGINT NOT NULL DEFAULT 0,
+	deliveries INT NOT NULL DEFAULT 0
+)`, b.tasks, d.autoIncrementPK, d.textType, d.textType),
+		d.createIndex(b.tasks+"_execute_at", b.tasks, "minute, status, execute_at"),
+		d.createIndex(b.tasks+"_lease_deadline", b.tasks, "minute, status, lease_deadline"),
+		d.createIndex(b.tasks+"_body_hash", b.tasks, "minute, body_hash"),
+
+		// 已删除任务的 key
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	minute BIGINT NOT NULL,
+	task_key VARCHAR(255) NOT NULL,
+	expire_at BIGINT NOT NULL,
+	PRIMARY KEY (minute, task_key)
+)`, b.deleted),
+		d.createIndex(b.deleted+"_expire_at", b.deleted, "expire_at"),
+
+		// 水位等单值数据
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	name VARCHAR(64) NOT NULL PRIMARY KEY,
+	value BIGINT NOT NULL
+)`, b.meta),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	name VARCHAR(64) NOT NULL PRIMARY KEY,
+	holder VARCHAR(255) NOT NULL,
+	expire_at BIGINT NOT NULL,
+	token BIGINT NOT NULL
+)`, b.leader),
+
+		// 死信
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id %s,
+	body %s NOT NULL,
+	body_hash CHAR(40) NOT NULL UNIQUE,
+	failed_at BIGINT NOT NULL
+)`, b.deadLetters, d.autoIncrementPK, d.textType),
+		d.createIndex(b.deadLetters+"_failed_at", b.deadLetters, "failed_at"),
+	}
+}
+
+// taskIndexSchema key 索引，指向 key 最近一次写入的任务
+func taskIndexSchema(b *Backend) []string {
+	return []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	task_key VARCHAR(255) NOT NULL PRIMARY KEY,
+	execute_at BIGINT NOT NULL,
+	body %s NOT NULL,
+	body_hash CHAR(40) NOT NULL
+)`, b.taskIndex, b.dialect.textType),
+	}
+}
+
+// seed 迁移完成后写入的初始数据，重复执行时忽略
+func (b *Backend) seed(ctx context.Context) error {
+	if _, err := b.exec(ctx, b.db, b.dialect.insertIgnoreQuery(b.meta, "name", "value"), watermarkName, 0); err != nil {
+		return err
+	}
+	_, err := b.exec(ctx, b.db, b.dialect.insertIgnoreQuery(b.leader, "name", "holder", "expire_at", "token"), leaderName, "", 0, 0)
+	return err
+}
+
+// Migrate 创建或者升级存储后端使用的表，可以重复执行
+// 已执行的版本记录在 <prefix>migrations 表中，多个实例并发执行时只有一个实例的变更会生效
+func (b *Backend) Migrate(ctx context.Context) error {
+	if _, err := b.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	version INT NOT NULL PRIMARY KEY,
+	applied_at BIGINT NOT NULL
+)`, b.migrations)); err != nil {
+		return fmt.Errorf("sqlbackend: create migrations table: %w", err)
+	}
+
+	applied := make(map[int]bool)
+	rows, err := b.db.QueryContext(ctx, fmt.Sprintf("SELECT version FROM %s", b.migrations))
+	if err != nil {
+		return fmt.Errorf("sqlbackend: query migrations: %w", err)
+	}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			rows.Close()
+			return err
+		}
+		applied[version] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+		if err := b.apply(ctx, m); err != nil {
+			// 其他实例已经完成了该版本的变更
+			if done, _ := b.applied(ctx, m.version); done {
+				continue
+			}
+			return fmt.Errorf("sqlbackend: migrate version %d: %w", m.version, err)
+		}
+	}
+	return b.seed(ctx)
+}
+
+// applied 版本是否已执行
+func (b *Backend) applied(ctx context.Context, version int) (bool, error) {
+	var n int
+	err := b.queryRow(ctx, b.db, fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE version = ?", b.migrations), version).Scan(&n)
+	return n > 0, err
+}
+
+// apply 在事务中执行一个版本的变更. 先写入版本记录，并发执行时后写入的实例因主键冲突回滚
+// 注意 MySQL 的 DDL 会隐式提交事务，依赖 IF NOT EXISTS 保证重复执行无副作用
+func (b *Backend) apply(ctx context.Context, m migration) error {
+	return b.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := b.exec(ctx, tx, fmt.Sprintf("INSERT INTO %s (version, applied_at) VALUES (?, ?)", b.migrations),
+			m.version, time.Now().UnixMilli()); err != nil {
+			return err
+		}
+		for _, stmt := range m.stmts(b) {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
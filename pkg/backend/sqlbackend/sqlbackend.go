@@ -0,0 +1,618 @@
+// Package sqlbackend 实现基于 database/sql 的分布式时间轮存储后端
+//
+// 任务保存在按照执行时间建立索引的任务表中. 支持 SELECT ... FOR UPDATE SKIP LOCKED 的数据库（PostgreSQL、MySQL 8）
+// 在事务中锁定并取出任务，多个实例互不阻塞；其他数据库（例如 SQLite）通过带条件的乐观更新取出任务，
+// 只有更新成功的实例取得任务. 使用前需要调用 Migrate 创建表.
+//
+// 租约、删除标识、处理中的任务以及 leader 的到期时间均以实例的本地时钟计算，各实例之间需要保持时钟同步.
+// 任务 key 保存在 VARCHAR(255) 列中，超过 MaxKeyLength 个字符的 key 写入时返回 ErrKeyTooLong.
+package sqlbackend
+
+import (
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dej4vu/timewheel/pkg/backend"
+)
+
+var _ backend.Backend = (*Backend)(nil)
+
+// MaxKeyLength 任务 key 的最大字符数，与 key 所在列的长度一致
+const MaxKeyLength = 255
+
+// ErrKeyTooLong 任务 key 超过 MaxKeyLength 个字符
+var ErrKeyTooLong = errors.New("sqlbackend: task key too long")
+
+// errIndexChanged 条件替换时 key 索引已不再指向原任务，回滚事务
+var errIndexChanged = errors.New("sqlbackend: key index changed")
+
+const (
+	// 删除标识在执行时间之后的保留时长，与 redis 实现保持一致
+	deletedTTL = time.Hour
+	// 清理过期删除标识以及处理中任务的时间间隔
+	sweepInterval = time.Minute
+
+	// 任务状态
+	statusPending    = 0
+	statusProcessing = 1
+
+	watermarkName = "watermark"
+	leaderName    = "leader"
+)
+
+// Backend 基于 database/sql 的存储后端，并发安全
+type Backend struct {
+	db      *sql.DB
+	dialect *Dialect
+	// 是否通过 SKIP LOCKED 取出任务
+	skipLocked bool
+
+	// 表名
+	tasks       string
+	deleted     string
+	meta        string
+	leader      string
+	deadLetters string
+	taskIndex   string
+	migrations  string
+
+	// 上一次清理过期删除标识以及处理中任务的毫秒级时间戳
+	lastSweep atomic.Int64
+}
+
+// Option 存储后端的配置项
+type Option func(*Backend)
+
+// WithTablePrefix 表名前缀，默认为 timewheel_
+func WithTablePrefix(prefix string) Option {
+	return func(b *Backend) {
+		b.setTables(prefix)
+	}
+}
+
+// WithSkipLocked 是否通过 SKIP LOCKED 取出任务，默认取决于方言. 数据库版本不支持 SKIP LOCKED 时需要关闭
+func WithSkipLocked(skipLocked bool) Option {
+	return func(b *Backend) {
+		b.skipLocked = skipLocked
+	}
+}
+
+// New 构造基于 database/sql 的存储后端
+func New(db *sql.DB, dialect *Dialect, opts ...Option) *Backend {
+	b := &Backend{
+		db:         db,
+		dialect:    dialect,
+		skipLocked: dialect.SkipLocked,
+	}
+	b.setTables("timewheel_")
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+func (b *Backend) setTables(prefix string) {
+	b.tasks = prefix + "tasks"
+	b.deleted = prefix + "deleted"
+	b.meta = prefix + "meta"
+	b.leader = prefix + "leader"
+	b.deadLetters = prefix + "dead_letters"
+	b.taskIndex = prefix + "task_index"
+	b.migrations = prefix + "migrations"
+}
+
+func (b *Backend) Add(ctx context.Context, task backend.Task) (bool, error) {
+	if err := checkKey(task.Key); err != nil {
+		return false, err
+	}
+	var replaced bool
+	err := b.withTx(ctx, func(tx *sql.Tx) (err error) {
+		replaced, err = b.add(ctx, tx, task, nil)
+		return err
+	})
+	return replaced, err
+}
+
+func (b *Backend) Replace(ctx context.Context, old, task backend.Task) (bool, error) {
+	if err := checkKey(task.Key); err != nil {
+		return false, err
+	}
+	err := b.withTx(ctx, func(tx *sql.Tx) error {
+		_, err := b.add(ctx, tx, task, &old)
+		return err
+	})
+	if errors.Is(err, errIndexChanged) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// add 写入任务并将 key 索引指向该任务，返回是否替换了 key 索引原先指向的任务
+// old 不为空时，key 索引原先指向的任务与 old 不一致则返回 errIndexChanged
+func (b *Backend) add(ctx context.Context, tx *sql.Tx, task backend.Task, old *backend.Task) (bool, error) {
+	minute := minuteKey(task.ExecuteAt)
+	hash := bodyHash(task.Body)
+	if _, err := b.exec(ctx, tx, fmt.Sprintf("DELETE FROM %s WHERE minute = ? AND task_key = ?", b.deleted),
+		minute, task.Key); err != nil {
+		return false, err
+	}
+	replaced, err := b.index(ctx, tx, task, hash, old)
+	if err != nil {
+		return false, err
+	}
+
+	// 与 redis 实现一致，时间片内相同的待执行任务只保存一份，重复写入时更新执行时间
+	res, err := b.exec(ctx, tx, fmt.Sprintf(
+		"UPDATE %s SET execute_at = ? WHERE minute = ? AND body_hash = ? AND status = ?", b.tasks),
+		task.ExecuteAt.UnixMilli(), minute, hash, statusPending)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return replaced, err
+	}
+
+	_, err = b.exec(ctx, tx, fmt.Sprintf(
+		"INSERT INTO %s (minute, task_key, body, body_hash, execute_at, status, lease_deadline) VALUES (?, ?, ?, ?, ?, ?, 0)", b.tasks),
+		minute, task.Key, task.Body, hash, task.ExecuteAt.UnixMilli(), statusPending)
+	return replaced, err
+}
+
+// index 将 key 索引指向任务，并将 key 索引原先指向的任务从待执行以及处理中的任务中移除，返回 key 索引是否指向了任务
+// 先以 insertLock 写入空的占位行或者锁定已存在的行，再读取原先指向的任务，同一 key 的写入在各个数据库中均串行执行
+// old 不为空时，key 索引原先指向的任务与 old 不一致则返回 errIndexChanged
+func (b *Backend) index(ctx context.Context, tx *sql.Tx, task backend.Task, hash string, old *backend.Task) (bool, error) {
+	if _, err := b.exec(ctx, tx, b.dialect.insertLockQuery(b.taskIndex, "task_key", "execute_at", "task_key", "execute_at", "body", "body_hash"),
+		task.Key, 0, "", ""); err != nil {
+		return false, err
+	}
+
+	var (
+		oldExecuteAt int64
+		oldHash      string
+	)
+	if err := b.queryRow(ctx, tx, fmt.Sprintf("SELECT execute_at, body_hash FROM %s WHERE task_key = ?", b.taskIndex),
+		task.Key).Scan(&oldExecuteAt, &oldHash); err != nil {
+		return false, err
+	}
+	if old != nil && (oldHash != bodyHash(old.Body) || oldExecuteAt != old.ExecuteAt.UnixMilli()) {
+		return false, errIndexChanged
+	}
+	// 占位行的摘要为空
+	replaced := oldHash != ""
+	if replaced {
+		if _, err := b.exec(ctx, tx, fmt.Sprintf("DELETE FROM %s WHERE minute = ? AND body_hash = ?", b.tasks),
+			minuteKey(time.UnixMilli(oldExecuteAt)), oldHash); err != nil {
+			return false, err
+		}
+	}
+
+	_, err := b.exec(ctx, tx, fmt.Sprintf("UPDATE %s SET execute_at = ?, body = ?, body_hash = ? WHERE task_key = ?", b.taskIndex),
+		task.ExecuteAt.UnixMilli(), task.Body, hash, task.Key)
+	return replaced, err
+}
+
+func (b *Backend) Remove(ctx context.Context, key string, executeAt time.Time) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	b.sweep(ctx)
+	minute := minuteKey(executeAt)
+	return b.withTx(ctx, func(tx *sql.Tx) error {
+		if err := b.remove(ctx, tx, key, executeAt); err != nil {
+			return err
+		}
+		// key 索引指向该时间片内的任务时一并删除，并将任务从待执行的任务中移除
+		var hash string
+		err := b.queryRow(ctx, tx, fmt.Sprintf("SELECT body_hash FROM %s WHERE task_key = ? AND execute_at >= ? AND execute_at < ?", b.taskIndex),
+			key, minute, minute+time.Minute.Milliseconds()).Scan(&hash)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := b.exec(ctx, tx, fmt.Sprintf("DELETE FROM %s WHERE task_key = ? AND body_hash = ?", b.taskIndex), key, hash); err != nil {
+			return err
+		}
+		_, err = b.exec(ctx, tx, fmt.Sprintf("DELETE FROM %s WHERE minute = ? AND status = ? AND body_hash = ?", b.tasks),
+			minute, statusPending, hash)
+		return err
+	})
+}
+
+// remove 在执行时间对应的时间片内标识 key 已删除
+func (b *Backend) remove(ctx context.Context, q querier, key string, executeAt time.Time) error {
+	_, err := b.exec(ctx, q, b.dialect.insertIgnoreQuery(b.deleted, "minute", "task_key", "expire_at"),
+		minuteKey(executeAt), key, executeAt.Add(deletedTTL).UnixMilli())
+	return err
+}
+
+func (b *Backend) Lookup(ctx context.Context, key string) (*backend.Task, error) {
+	task := backend.Task{Key: key}
+	var executeAt int64
+	err := b.queryRow(ctx, b.db, fmt.Sprintf("SELECT execute_at, body FROM %s WHERE task_key = ?", b.taskIndex), key).
+		Scan(&executeAt, &task.Body)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	task.ExecuteAt = time.UnixMilli(executeAt)
+	return &task, nil
+}
+
+func (b *Backend) RemoveKey(ctx context.Context, key string) (*backend.Task, error) {
+	var removed *backend.Task
+	err := b.withTx(ctx, func(tx *sql.Tx) error {
+		task := backend.Task{Key: key}
+		var (
+			executeAt int64
+			hash      string
+		)
+		err := b.queryRow(ctx, tx, fmt.Sprintf("SELECT execute_at, body, body_hash FROM %s WHERE task_key = ?", b.taskIndex), key).
+			Scan(&executeAt, &task.Body, &hash)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		task.ExecuteAt = time.UnixMilli(executeAt)
+
+		// 以摘要作为条件删除，key 索引被并发修改时不会误删
+		res, err := b.exec(ctx, tx, fmt.Sprintf("DELETE FROM %s WHERE task_key = ? AND body_hash = ?", b.taskIndex), key, hash)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		// 从待执行的任务中移除，已被取出的任务通过删除标识跳过
+		if _, err := b.exec(ctx, tx, fmt.Sprintf("DELETE FROM %s WHERE minute = ? AND status = ? AND body_hash = ?", b.tasks),
+			minuteKey(task.ExecuteAt), statusPending, hash); err != nil {
+			return err
+		}
+		if err := b.remove(ctx, tx, key, task.ExecuteAt); err != nil {
+			return err
+		}
+		removed = &task
+		return nil
+	})
+	return removed, err
+}
+
+func (b *Backend) Claim(ctx context.Context, minute, from, to time.Time, limit int, leaseDeadline time.Time) (*backend.Claimed, error) {
+	b.sweep(ctx)
+	return b.claim(ctx, minute, limit, leaseDeadline, statusPending,
+		"execute_at > ? AND execute_at <= ?", "execute_at, id", from.UnixMilli(), to.UnixMilli())
+}
+
+func (b *Backend) Reclaim(ctx context.Context, minute, now time.Time, limit int, leaseDeadline time.Time) (*backend.Claimed, error) {
+	return b.claim(ctx, minute, limit, leaseDeadline, statusProcessing,
+		"lease_deadline <= ?", "lease_deadline, execute_at, id", now.UnixMilli())
+}
+
+// candidate 待取出的任务
+type candidate struct {
+	id            int64
+	body          string
+	leaseDeadline int64
+	deliveries    int
+}
+
+// claim 从时间片中取出状态为 status 并且满足 cond 的任务，转入处理中并将租约设置为 leaseDeadline，取出次数加 1
+// 待执行任务的取出次数为 0，首次取出后记为 1
+func (b *Backend) claim(ctx context.Context, minute time.Time, limit int, leaseDeadline time.Time,
+	status int, cond, order string, args ...interface{}) (*backend.Claimed, error) {
+	m := minuteKey(minute)
+	deleted, err := b.deletedKeys(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf("SELECT id, body, lease_deadline, deliveries FROM %s WHERE minute = ? AND status = ? AND %s ORDER BY %s LIMIT ?",
+		b.tasks, cond, order)
+	args = append([]interface{}{m, status}, append(args, limit)...)
+
+	claimed := &backend.Claimed{Deleted: deleted}
+	if b.skipLocked {
+		err = b.withTx(ctx, func(tx *sql.Tx) error {
+			candidates, err := b.candidates(ctx, tx, query+" FOR UPDATE SKIP LOCKED", args...)
+			if err != nil || len(candidates) == 0 {
+				return err
+			}
+
+			ids := make([]interface{}, 0, len(candidates)+2)
+			ids = append(ids, statusProcessing, leaseDeadline.UnixMilli())
+			for _, c := range candidates {
+				ids = append(ids, c.id)
+			}
+			if _, err := b.exec(ctx, tx, fmt.Sprintf("UPDATE %s SET status = ?, lease_deadline = ?, deliveries = deliveries + 1 WHERE id IN (%s)",
+				b.tasks, placeholders(len(candidates))), ids...); err != nil {
+				return err
+			}
+			for _, c := range candidates {
+				claimed.Bodies = append(claimed.Bodies, c.body)
+				claimed.Deliveries = append(claimed.Deliveries, c.deliveries+1)
+			}
+			return nil
+		})
+		return claimed, err
+	}
+
+	candidates, err := b.candidates(ctx, b.db, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range candidates {
+		// 任务在查询之后被其他实例取出时状态或者租约已变更，更新不会生效
+		res, err := b.exec(ctx, b.db, fmt.Sprintf(
+			"UPDATE %s SET status = ?, lease_deadline = ?, deliveries = deliveries + 1 WHERE id = ? AND status = ? AND lease_deadline = ?", b.tasks),
+			statusProcessing, leaseDeadline.UnixMilli(), c.id, status, c.leaseDeadline)
+		if err != nil {
+			return nil, err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return nil, err
+		} else if n == 1 {
+			claimed.Bodies = append(claimed.Bodies, c.body)
+			claimed.Deliveries = append(claimed.Deliveries, c.deliveries+1)
+		}
+	}
+	return claimed, nil
+}
+
+func (b *Backend) candidates(ctx context.Context, q querier, query string, args ...interface{}) ([]candidate, error) {
+	rows, err := q.QueryContext(ctx, b.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []candidate
+	for rows.Next() {
+		var c candidate
+		if err := rows.Scan(&c.id, &c.body, &c.leaseDeadline, &c.deliveries); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, rows.Err()
+}
+
+// deletedKeys 获取时间片内未过期的删除标识
+func (b *Backend) deletedKeys(ctx context.Context, minute int64) ([]string, error) {
+	rows, err := b.db.QueryContext(ctx, b.dialect.rebind(fmt.Sprintf(
+		"SELECT task_key FROM %s WHERE minute = ? AND expire_at > ?", b.deleted)), minute, time.Now().UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (b *Backend) Ack(ctx context.Context, minute time.Time, tasks ...backend.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	return b.withTx(ctx, func(tx *sql.Tx) error {
+		args := make([]interface{}, 0, len(tasks)+2)
+		args = append(args, minuteKey(minute), statusProcessing)
+		for _, task := range tasks {
+			args = append(args, bodyHash(task.Body))
+		}
+		if _, err := b.exec(ctx, tx, fmt.Sprintf("DELETE FROM %s WHERE minute = ? AND status = ? AND body_hash IN (%s)",
+			b.tasks, placeholders(len(tasks))), args...); err != nil {
+			return err
+		}
+
+		// key 索引仍然指向该任务时一并删除
+		for _, task := range tasks {
+			if task.Key == "" {
+				continue
+			}
+			if _, err := b.exec(ctx, tx, fmt.Sprintf("DELETE FROM %s WHERE task_key = ? AND body_hash = ?", b.taskIndex),
+				task.Key, bodyHash(task.Body)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *Backend) Watermark(ctx context.Context) (time.Time, error) {
+	var watermark int64
+	err := b.queryRow(ctx, b.db, fmt.Sprintf("SELECT value FROM %s WHERE name = ?", b.meta), watermarkName).Scan(&watermark)
+	if err != nil && err != sql.ErrNoRows {
+		return time.Time{}, err
+	}
+	if watermark == 0 {
+		return time.Time{}, nil
+	}
+	return time.UnixMilli(watermark), nil
+}
+
+func (b *Backend) AdvanceWatermark(ctx context.Context, watermark time.Time) error {
+	_, err := b.exec(ctx, b.db, fmt.Sprintf("UPDATE %s SET value = ? WHERE name = ? AND value < ?", b.meta),
+		watermark.UnixMilli(), watermarkName, watermark.UnixMilli())
+	return err
+}
+
+func (b *Backend) AcquireLeader(ctx context.Context, id string, ttl time.Duration) (int64, error) {
+	var token int64
+	err := b.withTx(ctx, func(tx *sql.Tx) error {
+		now := time.Now()
+		// 续期
+		res, err := b.exec(ctx, tx, fmt.Sprintf(
+			"UPDATE %s SET expire_at = ? WHERE name = ? AND holder = ? AND expire_at > ?", b.leader),
+			now.Add(ttl).UnixMilli(), leaderName, id, now.UnixMilli())
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		// 租约空闲或者已到期时接管，fencing token 递增
+		if n == 0 {
+			res, err = b.exec(ctx, tx, fmt.Sprintf(
+				"UPDATE %s SET holder = ?, expire_at = ?, token = token + 1 WHERE name = ? AND (holder = '' OR expire_at <= ?)", b.leader),
+				id, now.Add(ttl).UnixMilli(), leaderName, now.UnixMilli())
+			if err != nil {
+				return err
+			}
+			if n, err = res.RowsAffected(); err != nil || n == 0 {
+				return err
+			}
+		}
+
+		return b.queryRow(ctx, tx, fmt.Sprintf("SELECT token FROM %s WHERE name = ?", b.leader), leaderName).Scan(&token)
+	})
+	return token, err
+}
+
+func (b *Backend) ReleaseLeader(ctx context.Context, id string) error {
+	_, err := b.exec(ctx, b.db, fmt.Sprintf("UPDATE %s SET holder = '' WHERE name = ? AND holder = ?", b.leader),
+		leaderName, id)
+	return err
+}
+
+func (b *Backend) AddDeadLetter(ctx context.Context, failedAt time.Time, body string) error {
+	hash := bodyHash(body)
+	return b.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := b.exec(ctx, tx, fmt.Sprintf("UPDATE %s SET failed_at = ? WHERE body_hash = ?", b.deadLetters),
+			failedAt.UnixMilli(), hash)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n > 0 {
+			return err
+		}
+		_, err = b.exec(ctx, tx, b.dialect.insertIgnoreQuery(b.deadLetters, "body", "body_hash", "failed_at"),
+			body, hash, failedAt.UnixMilli())
+		return err
+	})
+}
+
+func (b *Backend) RangeDeadLetters(ctx context.Context, offset, limit int) ([]string, error) {
+	rows, err := b.db.QueryContext(ctx, b.dialect.rebind(fmt.Sprintf(
+		"SELECT body FROM %s ORDER BY failed_at, id LIMIT ? OFFSET ?", b.deadLetters)), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bodies []string
+	for rows.Next() {
+		var body string
+		if err := rows.Scan(&body); err != nil {
+			return nil, err
+		}
+		bodies = append(bodies, body)
+	}
+	return bodies, rows.Err()
+}
+
+func (b *Backend) RemoveDeadLetters(ctx context.Context, bodies ...string) error {
+	if len(bodies) == 0 {
+		return nil
+	}
+
+	hashes := make([]interface{}, 0, len(bodies))
+	for _, body := range bodies {
+		hashes = append(hashes, bodyHash(body))
+	}
+	_, err := b.exec(ctx, b.db, fmt.Sprintf("DELETE FROM %s WHERE body_hash IN (%s)",
+		b.deadLetters, placeholders(len(bodies))), hashes...)
+	return err
+}
+
+func (b *Backend) PurgeDeadLetters(ctx context.Context, before time.Time) (int, error) {
+	res, err := b.exec(ctx, b.db, fmt.Sprintf("DELETE FROM %s WHERE failed_at <= ?", b.deadLetters), before.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// sweep 定期清理过期的删除标识，以及最近一次租约到期 backend.ProcessingTTL 之后仍未确认的任务，清理失败时等待下一次清理
+func (b *Backend) sweep(ctx context.Context) {
+	now := time.Now().UnixMilli()
+	last := b.lastSweep.Load()
+	if now-last < sweepInterval.Milliseconds() || !b.lastSweep.CompareAndSwap(last, now) {
+		return
+	}
+	_, _ = b.exec(ctx, b.db, fmt.Sprintf("DELETE FROM %s WHERE expire_at <= ?", b.deleted), now)
+
+	// 租约不早于执行时间，过期的任务所属的分钟同样早于 expired
+	expired := now - backend.ProcessingTTL.Milliseconds()
+	_, _ = b.exec(ctx, b.db, fmt.Sprintf("DELETE FROM %s WHERE minute <= ? AND status = ? AND lease_deadline <= ?", b.tasks),
+		expired, statusProcessing, expired)
+}
+
+// querier *sql.DB 与 *sql.Tx 的公共方法
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func (b *Backend) exec(ctx context.Context, q querier, query string, args ...interface{}) (sql.Result, error) {
+	return q.ExecContext(ctx, b.dialect.rebind(query), args...)
+}
+
+func (b *Backend) queryRow(ctx context.Context, q querier, query string, args ...interface{}) *sql.Row {
+	return q.QueryRowContext(ctx, b.dialect.rebind(query), args...)
+}
+
+// withTx 在事务中执行 fn，fn 返回错误时回滚
+func (b *Backend) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// checkKey 校验任务 key 的长度
+func checkKey(key string) error {
+	if utf8.RuneCountInString(key) > MaxKeyLength {
+		return fmt.Errorf("%w: %d characters, max %d", ErrKeyTooLong, utf8.RuneCountInString(key), MaxKeyLength)
+	}
+	return nil
+}
+
+// bodyHash 任务明细的摘要，用于索引以及去重
+func bodyHash(body string) string {
+	sum := sha1.Sum([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+func minuteKey(t time.Time) int64 {
+	return t.Truncate(time.Minute).UnixMilli()
+}
@@ -0,0 +1,55 @@
+// Package codec 定义分布式时间轮中类型化任务内容的编解码接口
+//
+// 编解码器按照名称注册，任务中记录写入时使用的编解码器名称，执行时据此选择编解码器解码.
+// 内置 json 编解码器，msgpack、protobuf 编解码器在导入对应的子包时注册.
+package codec
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Codec 任务内容的编解码器
+type Codec interface {
+	// Name 编解码器名称，写入任务中用于解码时选择编解码器，注册后不可修改
+	Name() string
+	// Marshal 编码任务内容
+	Marshal(v interface{}) ([]byte, error)
+	// Unmarshal 将任务内容解码到 v 中，v 为指针
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	mu     sync.RWMutex
+	codecs = map[string]Codec{}
+)
+
+func init() {
+	Register(JSON)
+}
+
+// Register 注册编解码器，相同名称的编解码器会被覆盖
+func Register(c Codec) {
+	mu.Lock()
+	defer mu.Unlock()
+	codecs[c.Name()] = c
+}
+
+// Get 获取指定名称的编解码器
+func Get(name string) (Codec, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	c, ok := codecs[name]
+	return c, ok
+}
+
+// JSON 基于 encoding/json 的编解码器
+var JSON Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
@@ -0,0 +1,16 @@
+module github.com/dej4vu/timewheel/pkg/codec/msgpack
+
+go 1.23.0
+
+require (
+	github.com/dej4vu/timewheel v0.0.0-00010101000000-000000000000
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+)
+
+require (
+	github.com/demdxx/gocast v1.2.0 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+)
+
+replace github.com/dej4vu/timewheel => ../../..
@@ -0,0 +1,22 @@
+// Package msgpack 提供基于 MessagePack 的任务内容编解码器，导入时自动注册
+package msgpack
+
+import (
+	"github.com/dej4vu/timewheel/pkg/codec"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec 基于 MessagePack 的编解码器
+var Codec codec.Codec = msgpackCodec{}
+
+func init() {
+	codec.Register(Codec)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string { return "msgpack" }
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) { return msgpack.Marshal(v) }
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error { return msgpack.Unmarshal(data, v) }
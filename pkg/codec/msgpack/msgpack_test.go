@@ -0,0 +1,60 @@
+package msgpack_test
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dej4vu/timewheel"
+	"github.com/dej4vu/timewheel/pkg/backend/memory"
+	"github.com/dej4vu/timewheel/pkg/codec/msgpack"
+)
+
+type orderTimeout struct {
+	OrderID string `json:"orderId" msgpack:"orderId"`
+	Amount  int64  `json:"amount" msgpack:"amount"`
+}
+
+func Test_Codec(t *testing.T) {
+	want := orderTimeout{OrderID: "o1", Amount: 100}
+	data, err := msgpack.Codec.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := timewheel.DecodePayload[orderTimeout](&timewheel.RTaskElement{Codec: msgpack.Codec.Name(), Payload: data})
+	if err != nil || got != want {
+		t.Errorf("got = %+v, %v, want %+v", got, err, want)
+	}
+}
+
+// Test_RTimeWheel_Typed 以 msgpack 编码写入的类型化任务执行时解码
+func Test_RTimeWheel_Typed(t *testing.T) {
+	ctx := context.Background()
+	var (
+		mu       sync.Mutex
+		executed []orderTimeout
+	)
+	mux := timewheel.NewMux()
+	timewheel.HandleTypedFunc(mux, func(ctx context.Context, payload orderTimeout) error {
+		mu.Lock()
+		executed = append(executed, payload)
+		mu.Unlock()
+		return nil
+	})
+	rTimeWheel := timewheel.NewRTimeWheelWithBackend(memory.New(), mux.Execute, timewheel.WithPollInterval(100*time.Millisecond))
+	defer rTimeWheel.Stop()
+
+	want := []orderTimeout{{OrderID: "o1", Amount: 1}}
+	if err := timewheel.AddTyped(ctx, rTimeWheel, "o1", want[0], time.Now().Add(500*time.Millisecond), timewheel.WithCodec(msgpack.Codec)); err != nil {
+		t.Fatal(err)
+	}
+
+	<-time.After(1500 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(executed, want) {
+		t.Errorf("executed = %+v, want %+v", executed, want)
+	}
+}
@@ -0,0 +1,15 @@
+module github.com/dej4vu/timewheel/pkg/codec/protobuf
+
+go 1.23.0
+
+require (
+	github.com/dej4vu/timewheel v0.0.0-00010101000000-000000000000
+	google.golang.org/protobuf v1.36.9
+)
+
+require (
+	github.com/demdxx/gocast v1.2.0 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+)
+
+replace github.com/dej4vu/timewheel => ../../..
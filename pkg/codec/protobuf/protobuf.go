@@ -0,0 +1,49 @@
+// Package protobuf 提供基于 Protocol Buffers 的任务内容编解码器，导入时自动注册
+package protobuf
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/dej4vu/timewheel/pkg/codec"
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec 基于 Protocol Buffers 的编解码器，任务内容需要实现 proto.Message
+var Codec codec.Codec = protobufCodec{}
+
+func init() {
+	codec.Register(Codec)
+}
+
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string { return "protobuf" }
+
+func (protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("protobuf: %T does not implement proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+// Unmarshal v 为 proto.Message，或者指向 proto.Message 的指针. 后者在指针为空时分配新的消息
+func (protobufCodec) Unmarshal(data []byte, v interface{}) error {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, m)
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Pointer {
+		return fmt.Errorf("protobuf: %T does not implement proto.Message", v)
+	}
+	if rv.Elem().IsNil() {
+		rv.Elem().Set(reflect.New(rv.Elem().Type().Elem()))
+	}
+	m, ok := rv.Elem().Interface().(proto.Message)
+	if !ok {
+		return fmt.Errorf("protobuf: %T does not implement proto.Message", v)
+	}
+	return proto.Unmarshal(data, m)
+}
@@ -0,0 +1,24 @@
+package protobuf_test
+
+import (
+	"testing"
+
+	"github.com/dej4vu/timewheel"
+	"github.com/dej4vu/timewheel/pkg/codec/protobuf"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func Test_Codec(t *testing.T) {
+	data, err := protobuf.Codec.Marshal(wrapperspb.String("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := timewheel.DecodePayload[*wrapperspb.StringValue](&timewheel.RTaskElement{Codec: protobuf.Codec.Name(), Payload: data})
+	if err != nil || msg.GetValue() != "hello" {
+		t.Errorf("got = %v, %v, want hello", msg, err)
+	}
+
+	if _, err := protobuf.Codec.Marshal("hello"); err == nil {
+		t.Error("marshal non proto.Message should fail")
+	}
+}
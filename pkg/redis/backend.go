@@ -0,0 +1,374 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dej4vu/timewheel/pkg/backend"
+	"github.com/demdxx/gocast"
+)
+
+var _ backend.Backend = (*Backend)(nil)
+
+// 小于该值的水位为历史版本记录的秒级时间戳
+const legacyWatermarkLimit = 1e11
+
+// 通过 key 索引替换或者删除任务时，因并发修改而重试的次数上限
+const indexRetries = 10
+
+// errConcurrentModification 通过 key 索引替换或者删除任务时，任务持续被并发修改
+var errConcurrentModification = errors.New("redis: task modified concurrently")
+
+// ErrHashTagRequired 分片模式的 store 既没有设置 hash tag 也没有关闭 key 索引
+var ErrHashTagRequired = errors.New("redis: sharded store requires WithHashTag or WithoutKeyIndex")
+
+// Backend 基于 lua 脚本实现的 redis 存储后端
+type Backend struct {
+	store Store
+	keys  keyspace
+	// 是否维护 key 索引
+	keyIndex bool
+}
+
+// BackendOption redis 存储后端的可选配置
+type BackendOption func(b *Backend)
+
+// WithHashTag 所有任务相关的 key 使用相同的 hash tag
+// cluster、Ring 等分片模式下 key 索引需要与时间片在同一个 slot，必须设置该选项或者 WithoutKeyIndex 之一，
+// 设置 hash tag 时代价是任务数据集中在同一个节点
+func WithHashTag(tag string) BackendOption {
+	return func(b *Backend) {
+		b.keys.hashTag = tag
+	}
+}
+
+// WithoutKeyIndex 不维护 key 索引，只能通过 key 以及执行时间删除任务
+// 重复添加同一 key 的任务时不再替换原任务，两笔任务均会执行，需要先指定执行时间删除原任务.
+// 分片模式下不设置 hash tag 时需要显式设置该选项，时间片按照分钟分散在各个 slot 中
+func WithoutKeyIndex() BackendOption {
+	return func(b *Backend) {
+		b.keyIndex = false
+	}
+}
+
+// NewBackend 构造 redis 存储后端，默认维护 key 索引
+// store 为 cluster、Ring 等分片模式的客户端时，key 索引无法与按照分钟分散的时间片在同一个 slot，
+// 需要通过 WithHashTag 或者 WithoutKeyIndex 选择其一，否则返回 ErrHashTagRequired
+func NewBackend(store Store, opts ...BackendOption) (*Backend, error) {
+	b := &Backend{store: store, keyIndex: true}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.keyIndex && b.keys.hashTag == "" && isSharded(store) {
+		return nil, ErrHashTagRequired
+	}
+	return b, nil
+}
+
+// withIndex 开启 key 索引时，将 key 索引追加到 keys 中
+func (b *Backend) withIndex(keys ...string) []string {
+	if b.keyIndex {
+		keys = append(keys, b.keys.taskIndex())
+	}
+	return keys
+}
+
+func (b *Backend) Add(ctx context.Context, task backend.Task) (bool, error) {
+	if !b.keyIndex {
+		_, err := b.add(ctx, task, nil)
+		return false, err
+	}
+
+	// 读取 key 索引原先指向的任务，写入时校验其未被并发修改
+	for i := 0; i < indexRetries; i++ {
+		old, err := b.Lookup(ctx, task.Key)
+		if err != nil {
+			return false, err
+		}
+		ok, err := b.add(ctx, task, old)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return old != nil, nil
+		}
+	}
+	return false, errConcurrentModification
+}
+
+func (b *Backend) Replace(ctx context.Context, old, task backend.Task) (bool, error) {
+	if !b.keyIndex {
+		return false, backend.ErrKeyIndexDisabled
+	}
+	return b.add(ctx, task, &old)
+}
+
+// add 写入任务并替换 key 索引原先指向的任务 old. key 索引已被并发修改时返回 false
+func (b *Backend) add(ctx context.Context, task backend.Task, old *backend.Task) (bool, error) {
+	keys := b.withIndex(
+		// 分钟级 zset 时间片
+		b.keys.minuteSlice(task.ExecuteAt),
+		// 标识任务删除的集合
+		b.keys.deleteSet(task.ExecuteAt),
+	)
+	var oldIndexValue string
+	if old != nil {
+		// 原任务所属的时间片、处理中的 zset 以及取出次数的 hash
+		keys = append(keys, b.keys.minuteSlice(old.ExecuteAt), b.keys.processing(old.ExecuteAt), b.keys.deliveries(old.ExecuteAt))
+		oldIndexValue = indexValue(*old)
+	}
+
+	rawReply, err := AddTaskScript.Run(ctx, b.store, keys,
+		[]interface{}{
+			// 以执行时刻的毫秒级时间戳作为 zset 中的 score
+			task.ExecuteAt.UnixMilli(),
+			// 任务明细
+			task.Body,
+			// 任务 key，用于存放在删除集合中
+			task.Key,
+			// key 索引的值
+			indexValue(task),
+			// key 索引原先的值
+			oldIndexValue,
+		})
+	if err != nil {
+		return false, err
+	}
+	return gocast.ToInt(rawReply) >= 0, nil
+}
+
+func (b *Backend) Remove(ctx context.Context, key string, executeAt time.Time) error {
+	minute := executeAt.Truncate(time.Minute)
+	// 标识任务已被删除
+	_, err := DeleteTaskScript.Run(ctx, b.store,
+		b.withIndex(b.keys.deleteSet(executeAt), b.keys.minuteSlice(executeAt)),
+		[]interface{}{key, deleteSetTTL(executeAt), minute.UnixMilli(), minute.Add(time.Minute).UnixMilli()},
+	)
+	return err
+}
+
+func (b *Backend) Lookup(ctx context.Context, key string) (*backend.Task, error) {
+	if !b.keyIndex {
+		return nil, backend.ErrKeyIndexDisabled
+	}
+
+	rawReply, err := LookupTaskScript.Run(ctx, b.store, []string{b.keys.taskIndex()}, []interface{}{key})
+	if err != nil {
+		return nil, err
+	}
+	value := gocast.ToString(rawReply)
+	if value == "" {
+		return nil, nil
+	}
+	return parseIndexValue(key, value)
+}
+
+func (b *Backend) RemoveKey(ctx context.Context, key string) (*backend.Task, error) {
+	for i := 0; i < indexRetries; i++ {
+		task, err := b.Lookup(ctx, key)
+		if err != nil || task == nil {
+			return nil, err
+		}
+
+		rawReply, err := RemoveKeyScript.Run(ctx, b.store,
+			[]string{b.keys.taskIndex(), b.keys.minuteSlice(task.ExecuteAt), b.keys.deleteSet(task.ExecuteAt)},
+			[]interface{}{key, indexValue(*task), task.Body, deleteSetTTL(task.ExecuteAt)},
+		)
+		if err != nil {
+			return nil, err
+		}
+		if gocast.ToInt(rawReply) == 1 {
+			return task, nil
+		}
+	}
+	return nil, errConcurrentModification
+}
+
+func (b *Backend) Claim(ctx context.Context, minute, from, to time.Time, limit int, leaseDeadline time.Time) (*backend.Claimed, error) {
+	// 以毫秒级时间戳作为 score 进行 zset 检索，左开右闭
+	score1 := fmt.Sprintf("(%d", from.UnixMilli())
+	score2 := to.UnixMilli()
+	// 兼容以秒级时间戳作为 score 的历史任务
+	legacyScore1 := fmt.Sprintf("(%d", from.Unix())
+	legacyScore2 := to.Unix()
+	// 执行 lua 脚本，本质上是通过 zrange 指令结合毫秒级时间戳对应的 score 进行定时任务检索
+	// 检索到的任务转移到处理中的 zset，在租约到期前处理完成并 ack
+	rawReply, err := RangeTasksScript.Run(ctx, b.store,
+		[]string{b.keys.minuteSlice(minute), b.keys.deleteSet(minute), b.keys.processing(minute), b.keys.deliveries(minute)},
+		[]interface{}{score1, score2, leaseDeadline.UnixMilli(), limit, legacyScore1, legacyScore2, processingTTL(leaseDeadline)},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return parseClaimed(rawReply, false)
+}
+
+func (b *Backend) Reclaim(ctx context.Context, minute, now time.Time, limit int, leaseDeadline time.Time) (*backend.Claimed, error) {
+	rawReply, err := ReclaimTasksScript.Run(ctx, b.store,
+		[]string{b.keys.processing(minute), b.keys.deleteSet(minute), b.keys.deliveries(minute)},
+		[]interface{}{now.UnixMilli(), leaseDeadline.UnixMilli(), limit, processingTTL(leaseDeadline)},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return parseClaimed(rawReply, true)
+}
+
+func (b *Backend) Ack(ctx context.Context, minute time.Time, tasks ...backend.Task) error {
+	args := make([]interface{}, 0, 2*len(tasks))
+	for _, task := range tasks {
+		args = append(args, task.Key, indexValue(task))
+	}
+	_, err := AckTasksScript.Run(ctx, b.store,
+		b.withIndex(b.keys.processing(minute), b.keys.deliveries(minute)),
+		args,
+	)
+	return err
+}
+
+func (b *Backend) Watermark(ctx context.Context) (time.Time, error) {
+	rawReply, err := GetWatermarkScript.Run(ctx, b.store, []string{WatermarkKey}, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	switch watermark := gocast.ToInt64(rawReply); {
+	case watermark <= 0:
+		return time.Time{}, nil
+	case watermark < legacyWatermarkLimit:
+		// 历史版本记录的秒级水位
+		return time.Unix(watermark, 0), nil
+	default:
+		return time.UnixMilli(watermark), nil
+	}
+}
+
+func (b *Backend) AdvanceWatermark(ctx context.Context, watermark time.Time) error {
+	_, err := AdvanceWatermarkScript.Run(ctx, b.store,
+		[]string{WatermarkKey},
+		[]interface{}{watermark.UnixMilli()},
+	)
+	return err
+}
+
+func (b *Backend) AcquireLeader(ctx context.Context, id string, ttl time.Duration) (int64, error) {
+	rawReply, err := AcquireLeaderScript.Run(ctx, b.store,
+		[]string{LeaderKey, LeaderTokenKey},
+		[]interface{}{id, ttl.Milliseconds()},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return gocast.ToInt64(rawReply), nil
+}
+
+func (b *Backend) ReleaseLeader(ctx context.Context, id string) error {
+	_, err := ReleaseLeaderScript.Run(ctx, b.store,
+		[]string{LeaderKey},
+		[]interface{}{id},
+	)
+	return err
+}
+
+func (b *Backend) AddDeadLetter(ctx context.Context, failedAt time.Time, body string) error {
+	_, err := DeadLetterScript.Run(ctx, b.store,
+		[]string{DeadLetterKey},
+		[]interface{}{failedAt.UnixMilli(), body},
+	)
+	return err
+}
+
+func (b *Backend) RangeDeadLetters(ctx context.Context, offset, limit int) ([]string, error) {
+	rawReply, err := RangeDeadLettersScript.Run(ctx, b.store,
+		[]string{DeadLetterKey},
+		[]interface{}{offset, offset + limit - 1},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return gocast.ToStringSlice(rawReply), nil
+}
+
+func (b *Backend) RemoveDeadLetters(ctx context.Context, bodies ...string) error {
+	args := make([]interface{}, 0, len(bodies))
+	for _, body := range bodies {
+		args = append(args, body)
+	}
+	_, err := RemoveDeadLettersScript.Run(ctx, b.store,
+		[]string{DeadLetterKey},
+		args,
+	)
+	return err
+}
+
+func (b *Backend) PurgeDeadLetters(ctx context.Context, before time.Time) (int, error) {
+	rawReply, err := PurgeDeadLettersScript.Run(ctx, b.store,
+		[]string{DeadLetterKey},
+		[]interface{}{before.UnixMilli()},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return gocast.ToInt(rawReply), nil
+}
+
+// deleteSetTTL 删除集合的过期时间，为定时任务距离当前时间的秒数+3600s
+func deleteSetTTL(executeAt time.Time) int {
+	return int(time.Until(executeAt).Seconds()) + 3600
+}
+
+// processingTTL 处理中的 zset 的毫秒级过期时间，为租约到期之后 backend.ProcessingTTL
+func processingTTL(leaseDeadline time.Time) int64 {
+	return (time.Until(leaseDeadline) + backend.ProcessingTTL).Milliseconds()
+}
+
+// indexValue key 索引的值，格式为 执行时间的毫秒级时间戳:任务明细
+func indexValue(task backend.Task) string {
+	return strconv.FormatInt(task.ExecuteAt.UnixMilli(), 10) + ":" + task.Body
+}
+
+// parseIndexValue 解析 key 索引的值
+func parseIndexValue(key, value string) (*backend.Task, error) {
+	executeAt, body, ok := strings.Cut(value, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid task index value: %s", value)
+	}
+	ms, err := strconv.ParseInt(executeAt, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid task index value: %s", value)
+	}
+	return &backend.Task{Key: key, ExecuteAt: time.UnixMilli(ms), Body: body}, nil
+}
+
+// parseClaimed 解析取出任务的 lua 脚本的结果
+// 结果中，首个元素对应为已删除任务的 key 集合，后续元素对应为各笔定时任务
+// withDeliveries 为 true 时，每笔定时任务之后紧跟其取出次数，否则取出次数均为 1
+func parseClaimed(rawReply interface{}, withDeliveries bool) (*backend.Claimed, error) {
+	replies := gocast.ToInterfaceSlice(rawReply)
+	if len(replies) == 0 || (withDeliveries && len(replies)%2 == 0) {
+		return nil, fmt.Errorf("invalid replies: %v", replies)
+	}
+
+	step := 1
+	if withDeliveries {
+		step = 2
+	}
+	n := (len(replies) - 1) / step
+	claimed := &backend.Claimed{
+		Deleted:    gocast.ToStringSlice(replies[0]),
+		Bodies:     make([]string, 0, n),
+		Deliveries: make([]int, 0, n),
+	}
+	for i := 1; i < len(replies); i += step {
+		deliveries := 1
+		if withDeliveries {
+			deliveries = gocast.ToInt(replies[i+1])
+		}
+		claimed.Bodies = append(claimed.Bodies, gocast.ToString(replies[i]))
+		claimed.Deliveries = append(claimed.Deliveries, deliveries)
+	}
+	return claimed, nil
+}
@@ -0,0 +1,641 @@
+package fake
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dej4vu/timewheel/internal/zset"
+)
+
+var (
+	errWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errSyntax    = errors.New("ERR syntax error")
+	errNotInt    = errors.New("ERR value is not an integer or out of range")
+	errNotFloat  = errors.New("ERR min or max is not a float")
+)
+
+// kind 数据类型
+type kind int
+
+const (
+	kindString kind = iota
+	kindSet
+	kindZSet
+	kindHash
+)
+
+// entry 一个 key 对应的数据
+type entry struct {
+	kind kind
+	str  string
+	set  map[string]struct{}
+	zset *zset.Set
+	hash map[string]string
+	// 过期时间，为零值时不过期
+	expireAt time.Time
+}
+
+// empty 集合类型为空时，与 redis 一致删除 key
+func (e *entry) empty() bool {
+	switch e.kind {
+	case kindSet:
+		return len(e.set) == 0
+	case kindZSet:
+		return e.zset.Len() == 0
+	case kindHash:
+		return len(e.hash) == 0
+	default:
+		return false
+	}
+}
+
+// command 命令的实现，args 不包含命令名称
+type command struct {
+	// 参数数量的下限
+	arity int
+	exec  func(s *Store, args []string) (interface{}, error)
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"PING":             {0, (*Store).ping},
+		"FLUSHDB":          {0, (*Store).flushdb},
+		"GET":              {1, (*Store).get},
+		"SET":              {2, (*Store).set},
+		"DEL":              {1, (*Store).del},
+		"INCR":             {1, (*Store).incr},
+		"EXPIRE":           {2, (*Store).expire},
+		"PEXPIRE":          {2, (*Store).pexpire},
+		"PTTL":             {1, (*Store).pttl},
+		"SADD":             {2, (*Store).sadd},
+		"SREM":             {2, (*Store).srem},
+		"SMEMBERS":         {1, (*Store).smembers},
+		"SCARD":            {1, (*Store).scard},
+		"ZADD":             {3, (*Store).zadd},
+		"ZREM":             {2, (*Store).zrem},
+		"ZCARD":            {1, (*Store).zcard},
+		"ZRANGE":           {3, (*Store).zrange},
+		"ZRANGEBYSCORE":    {3, (*Store).zrangebyscore},
+		"ZREMRANGEBYSCORE": {3, (*Store).zremrangebyscore},
+		"HSET":             {3, (*Store).hset},
+		"HGET":             {2, (*Store).hget},
+		"HDEL":             {2, (*Store).hdel},
+		"HINCRBY":          {3, (*Store).hincrby},
+		"HLEN":             {1, (*Store).hlen},
+	}
+}
+
+// exec 执行一条命令，调用方需持有锁
+func (s *Store) exec(args []string) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, errors.New("ERR Please specify at least one argument for this redis lib call")
+	}
+	name := strings.ToUpper(args[0])
+	cmd, ok := commands[name]
+	if !ok {
+		return nil, fmt.Errorf("ERR unknown command '%s'", args[0])
+	}
+	if len(args)-1 < cmd.arity {
+		return nil, fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(name))
+	}
+	return cmd.exec(s, args[1:])
+}
+
+// lookup 获取未过期的 key，已过期的 key 惰性删除
+func (s *Store) lookup(key string) *entry {
+	e, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	if !e.expireAt.IsZero() && !s.now().Before(e.expireAt) {
+		delete(s.entries, key)
+		return nil
+	}
+	return e
+}
+
+// lookupKind 获取指定类型的 key，类型不一致时返回 WRONGTYPE 错误
+func (s *Store) lookupKind(key string, k kind) (*entry, error) {
+	e := s.lookup(key)
+	if e != nil && e.kind != k {
+		return nil, errWrongType
+	}
+	return e, nil
+}
+
+// lookupOrCreate 获取指定类型的 key，不存在时创建
+func (s *Store) lookupOrCreate(key string, k kind) (*entry, error) {
+	e, err := s.lookupKind(key, k)
+	if err != nil || e != nil {
+		return e, err
+	}
+
+	e = &entry{kind: k}
+	switch k {
+	case kindSet:
+		e.set = make(map[string]struct{})
+	case kindZSet:
+		e.zset = zset.New()
+	case kindHash:
+		e.hash = make(map[string]string)
+	}
+	s.entries[key] = e
+	return e, nil
+}
+
+// removeIfEmpty 集合为空时删除 key
+func (s *Store) removeIfEmpty(key string, e *entry) {
+	if e.empty() {
+		delete(s.entries, key)
+	}
+}
+
+func (s *Store) ping(args []string) (interface{}, error) {
+	return status("PONG"), nil
+}
+
+func (s *Store) flushdb(args []string) (interface{}, error) {
+	s.entries = make(map[string]*entry)
+	return status("OK"), nil
+}
+
+func (s *Store) get(args []string) (interface{}, error) {
+	e, err := s.lookupKind(args[0], kindString)
+	if err != nil || e == nil {
+		return nil, err
+	}
+	return e.str, nil
+}
+
+// set SET key value [NX | XX] [EX seconds | PX milliseconds]
+func (s *Store) set(args []string) (interface{}, error) {
+	key, val := args[0], args[1]
+	var nx, xx bool
+	var ttl time.Duration
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); opt {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				return nil, errSyntax
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return nil, errNotInt
+			}
+			if n <= 0 {
+				return nil, errors.New("ERR invalid expire time in 'set' command")
+			}
+			if opt == "EX" {
+				ttl = time.Duration(n) * time.Second
+			} else {
+				ttl = time.Duration(n) * time.Millisecond
+			}
+			i++
+		default:
+			return nil, errSyntax
+		}
+	}
+	if nx && xx {
+		return nil, errSyntax
+	}
+
+	exists := s.lookup(key) != nil
+	if (nx && exists) || (xx && !exists) {
+		return nil, nil
+	}
+
+	e := &entry{kind: kindString, str: val}
+	if ttl > 0 {
+		e.expireAt = s.now().Add(ttl)
+	}
+	s.entries[key] = e
+	return status("OK"), nil
+}
+
+func (s *Store) del(args []string) (interface{}, error) {
+	var n int64
+	for _, key := range args {
+		if s.lookup(key) != nil {
+			delete(s.entries, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *Store) incr(args []string) (interface{}, error) {
+	e, err := s.lookupKind(args[0], kindString)
+	if err != nil {
+		return nil, err
+	}
+
+	var n int64
+	if e != nil {
+		if n, err = strconv.ParseInt(e.str, 10, 64); err != nil {
+			return nil, errNotInt
+		}
+	} else {
+		e = &entry{kind: kindString}
+		s.entries[args[0]] = e
+	}
+	n++
+	e.str = strconv.FormatInt(n, 10)
+	return n, nil
+}
+
+func (s *Store) expire(args []string) (interface{}, error) {
+	return s.expireIn(args, time.Second)
+}
+
+func (s *Store) pexpire(args []string) (interface{}, error) {
+	return s.expireIn(args, time.Millisecond)
+}
+
+// expireIn 设置 key 的过期时间，过期时间不为正数时直接删除 key
+func (s *Store) expireIn(args []string, unit time.Duration) (interface{}, error) {
+	n, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return nil, errNotInt
+	}
+	e := s.lookup(args[0])
+	if e == nil {
+		return int64(0), nil
+	}
+	if n <= 0 {
+		delete(s.entries, args[0])
+		return int64(1), nil
+	}
+	e.expireAt = s.now().Add(time.Duration(n) * unit)
+	return int64(1), nil
+}
+
+// pttl 剩余的毫秒级过期时间，key 不存在时返回 -2，未设置过期时间时返回 -1
+func (s *Store) pttl(args []string) (interface{}, error) {
+	e := s.lookup(args[0])
+	switch {
+	case e == nil:
+		return int64(-2), nil
+	case e.expireAt.IsZero():
+		return int64(-1), nil
+	default:
+		return e.expireAt.Sub(s.now()).Milliseconds(), nil
+	}
+}
+
+// hset HSET key field value [field value ...]
+func (s *Store) hset(args []string) (interface{}, error) {
+	if len(args)%2 != 1 {
+		return nil, errors.New("ERR wrong number of arguments for 'hset' command")
+	}
+	e, err := s.lookupOrCreate(args[0], kindHash)
+	if err != nil {
+		return nil, err
+	}
+	var n int64
+	for i := 1; i < len(args); i += 2 {
+		if _, ok := e.hash[args[i]]; !ok {
+			n++
+		}
+		e.hash[args[i]] = args[i+1]
+	}
+	return n, nil
+}
+
+func (s *Store) hget(args []string) (interface{}, error) {
+	e, err := s.lookupKind(args[0], kindHash)
+	if err != nil || e == nil {
+		return nil, err
+	}
+	val, ok := e.hash[args[1]]
+	if !ok {
+		return nil, nil
+	}
+	return val, nil
+}
+
+func (s *Store) hincrby(args []string) (interface{}, error) {
+	delta, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return nil, errNotInt
+	}
+	e, err := s.lookupOrCreate(args[0], kindHash)
+	if err != nil {
+		return nil, err
+	}
+	var n int64
+	if val, ok := e.hash[args[1]]; ok {
+		if n, err = strconv.ParseInt(val, 10, 64); err != nil {
+			return nil, errors.New("ERR hash value is not an integer")
+		}
+	}
+	n += delta
+	e.hash[args[1]] = strconv.FormatInt(n, 10)
+	return n, nil
+}
+
+func (s *Store) hdel(args []string) (interface{}, error) {
+	e, err := s.lookupKind(args[0], kindHash)
+	if err != nil || e == nil {
+		return int64(0), err
+	}
+	var n int64
+	for _, field := range args[1:] {
+		if _, ok := e.hash[field]; ok {
+			delete(e.hash, field)
+			n++
+		}
+	}
+	s.removeIfEmpty(args[0], e)
+	return n, nil
+}
+
+func (s *Store) hlen(args []string) (interface{}, error) {
+	e, err := s.lookupKind(args[0], kindHash)
+	if err != nil || e == nil {
+		return int64(0), err
+	}
+	return int64(len(e.hash)), nil
+}
+
+func (s *Store) sadd(args []string) (interface{}, error) {
+	e, err := s.lookupOrCreate(args[0], kindSet)
+	if err != nil {
+		return nil, err
+	}
+	var n int64
+	for _, member := range args[1:] {
+		if _, ok := e.set[member]; !ok {
+			e.set[member] = struct{}{}
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *Store) srem(args []string) (interface{}, error) {
+	e, err := s.lookupKind(args[0], kindSet)
+	if err != nil || e == nil {
+		return int64(0), err
+	}
+	var n int64
+	for _, member := range args[1:] {
+		if _, ok := e.set[member]; ok {
+			delete(e.set, member)
+			n++
+		}
+	}
+	s.removeIfEmpty(args[0], e)
+	return n, nil
+}
+
+// smembers 集合中的元素按照字典序返回，便于测试断言
+func (s *Store) smembers(args []string) (interface{}, error) {
+	e, err := s.lookupKind(args[0], kindSet)
+	if err != nil {
+		return nil, err
+	}
+	members := []interface{}{}
+	if e == nil {
+		return members, nil
+	}
+	names := make([]string, 0, len(e.set))
+	for member := range e.set {
+		names = append(names, member)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		members = append(members, name)
+	}
+	return members, nil
+}
+
+func (s *Store) scard(args []string) (interface{}, error) {
+	e, err := s.lookupKind(args[0], kindSet)
+	if err != nil || e == nil {
+		return int64(0), err
+	}
+	return int64(len(e.set)), nil
+}
+
+// zadd ZADD key score member [score member ...]
+func (s *Store) zadd(args []string) (interface{}, error) {
+	if len(args[1:])%2 != 0 {
+		return nil, errSyntax
+	}
+	pairs := make([]zset.Member, 0, len(args[1:])/2)
+	for i := 1; i < len(args); i += 2 {
+		score, err := strconv.ParseFloat(args[i], 64)
+		if err != nil || math.IsNaN(score) {
+			return nil, errors.New("ERR value is not a valid float")
+		}
+		pairs = append(pairs, zset.Member{Name: args[i+1], Score: score})
+	}
+
+	e, err := s.lookupOrCreate(args[0], kindZSet)
+	if err != nil {
+		return nil, err
+	}
+	var n int64
+	for _, m := range pairs {
+		if e.zset.Add(m.Name, m.Score) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *Store) zrem(args []string) (interface{}, error) {
+	e, err := s.lookupKind(args[0], kindZSet)
+	if err != nil || e == nil {
+		return int64(0), err
+	}
+	var n int64
+	for _, member := range args[1:] {
+		if e.zset.Rem(member) {
+			n++
+		}
+	}
+	s.removeIfEmpty(args[0], e)
+	return n, nil
+}
+
+func (s *Store) zcard(args []string) (interface{}, error) {
+	e, err := s.lookupKind(args[0], kindZSet)
+	if err != nil || e == nil {
+		return int64(0), err
+	}
+	return int64(e.zset.Len()), nil
+}
+
+// zrange ZRANGE key start stop [BYSCORE] [LIMIT offset count] [WITHSCORES]
+func (s *Store) zrange(args []string) (interface{}, error) {
+	var byScore, withScores bool
+	offset, count := 0, -1
+	hasLimit := false
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "BYSCORE":
+			byScore = true
+		case "WITHSCORES":
+			withScores = true
+		case "LIMIT":
+			var err error
+			if offset, count, err = parseLimit(args, i); err != nil {
+				return nil, err
+			}
+			hasLimit = true
+			i += 2
+		default:
+			return nil, errSyntax
+		}
+	}
+	if hasLimit && !byScore {
+		return nil, errors.New("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+
+	e, err := s.lookupKind(args[0], kindZSet)
+	if err != nil {
+		return nil, err
+	}
+
+	var members []zset.Member
+	if byScore {
+		min, max, err := parseRange(args[1], args[2])
+		if err != nil {
+			return nil, err
+		}
+		if e != nil {
+			members = e.zset.RangeByScore(min, max, offset, count)
+		}
+	} else {
+		start, err1 := strconv.Atoi(args[1])
+		stop, err2 := strconv.Atoi(args[2])
+		if err1 != nil || err2 != nil {
+			return nil, errNotInt
+		}
+		if e != nil {
+			members = e.zset.Range(start, stop)
+		}
+	}
+	return memberReply(members, withScores), nil
+}
+
+// zrangebyscore ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count]
+func (s *Store) zrangebyscore(args []string) (interface{}, error) {
+	var withScores bool
+	offset, count := 0, -1
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "WITHSCORES":
+			withScores = true
+		case "LIMIT":
+			var err error
+			if offset, count, err = parseLimit(args, i); err != nil {
+				return nil, err
+			}
+			i += 2
+		default:
+			return nil, errSyntax
+		}
+	}
+
+	min, max, err := parseRange(args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	e, err := s.lookupKind(args[0], kindZSet)
+	if err != nil || e == nil {
+		return []interface{}{}, err
+	}
+	return memberReply(e.zset.RangeByScore(min, max, offset, count), withScores), nil
+}
+
+func (s *Store) zremrangebyscore(args []string) (interface{}, error) {
+	min, max, err := parseRange(args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	e, err := s.lookupKind(args[0], kindZSet)
+	if err != nil || e == nil {
+		return int64(0), err
+	}
+	n := e.zset.RemRangeByScore(min, max)
+	s.removeIfEmpty(args[0], e)
+	return int64(n), nil
+}
+
+// parseLimit 解析 LIMIT offset count，count 为负数时不限制数量
+func parseLimit(args []string, i int) (int, int, error) {
+	if i+2 >= len(args) {
+		return 0, 0, errSyntax
+	}
+	offset, err1 := strconv.Atoi(args[i+1])
+	count, err2 := strconv.Atoi(args[i+2])
+	if err1 != nil || err2 != nil {
+		return 0, 0, errNotInt
+	}
+	if offset < 0 {
+		// 与 redis 一致，offset 为负数时返回空
+		count = 0
+		offset = 0
+	}
+	if count < 0 {
+		count = -1
+	}
+	return offset, count, nil
+}
+
+// parseRange 解析 score 区间，支持 -inf、+inf 以及 ( 前缀表示的开区间
+func parseRange(min, max string) (zset.Bound, zset.Bound, error) {
+	minBound, err := parseBound(min)
+	if err != nil {
+		return zset.Bound{}, zset.Bound{}, err
+	}
+	maxBound, err := parseBound(max)
+	if err != nil {
+		return zset.Bound{}, zset.Bound{}, err
+	}
+	return minBound, maxBound, nil
+}
+
+func parseBound(s string) (zset.Bound, error) {
+	exclusive := strings.HasPrefix(s, "(")
+	s = strings.TrimPrefix(s, "(")
+
+	var score float64
+	switch strings.ToLower(s) {
+	case "-inf":
+		score = math.Inf(-1)
+	case "+inf", "inf":
+		score = math.Inf(1)
+	default:
+		var err error
+		if score, err = strconv.ParseFloat(s, 64); err != nil || math.IsNaN(score) {
+			return zset.Bound{}, errNotFloat
+		}
+	}
+	return zset.Bound{Score: score, Exclusive: exclusive}, nil
+}
+
+// memberReply 构造有序集合元素的返回值
+func memberReply(members []zset.Member, withScores bool) []interface{} {
+	reply := make([]interface{}, 0, len(members))
+	for _, m := range members {
+		reply = append(reply, m.Name)
+		if withScores {
+			reply = append(reply, strconv.FormatFloat(m.Score, 'g', 17, 64))
+		}
+	}
+	return reply
+}
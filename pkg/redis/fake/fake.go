@@ -0,0 +1,411 @@
+// Package fake 提供进程内的 redis 存储实现，通过 gopher-lua 执行内嵌的 lua 脚本
+//
+// 仅实现了时间轮的 lua 脚本使用到的命令，用于在没有 redis 服务的环境下测试脚本的行为.
+package fake
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dej4vu/timewheel/internal/keyslot"
+	store "github.com/dej4vu/timewheel/pkg/redis"
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+var _ store.ShardedStore = (*Store)(nil)
+
+var (
+	// ErrClosed 存储已关闭
+	ErrClosed = errors.New("fake: store closed")
+	// errNoScript 与 redis 一致的脚本不存在错误
+	errNoScript = errors.New("NOSCRIPT No matching script. Please use EVAL.")
+	// errCrossSlot 与 redis cluster 一致的跨 slot 错误
+	errCrossSlot = errors.New("CROSSSLOT Keys in request don't hash to the same slot")
+)
+
+// Store 进程内的 redis 存储，并发安全. 脚本与命令串行执行，与 redis 一致保证脚本的原子性
+type Store struct {
+	mu sync.Mutex
+	// 数据
+	entries map[string]*entry
+	// 已缓存的脚本，以 sha1 作为 key
+	scripts map[string]*lua.FunctionProto
+	// 时钟偏移量，用于模拟 key 过期
+	offset time.Duration
+	// 是否已关闭
+	closed bool
+	// 是否模拟 redis cluster
+	cluster bool
+}
+
+// New 构造空的进程内 redis 存储
+func New() *Store {
+	return &Store{
+		entries: make(map[string]*entry),
+		scripts: make(map[string]*lua.FunctionProto),
+	}
+}
+
+// NewCluster 构造模拟 redis cluster 的进程内 redis 存储
+// 数据仍然保存在同一个进程内，但与 redis cluster 一致，同一个脚本访问的 key 不在同一个 slot 时返回 CROSSSLOT 错误
+func NewCluster() *Store {
+	s := New()
+	s.cluster = true
+	return s
+}
+
+// Sharded 是否模拟 redis cluster
+func (s *Store) Sharded() bool {
+	return s.cluster
+}
+
+// FastForward 将时钟向后拨动 d，用于模拟 key 过期
+func (s *Store) FastForward(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offset += d
+}
+
+// Do 执行一条 redis 命令，返回值与 go-redis 一致：整数为 int64，字符串为 string，数组为 []interface{}，不存在为 nil
+func (s *Store) Do(ctx context.Context, args ...interface{}) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.check(ctx); err != nil {
+		return nil, err
+	}
+
+	strArgs := make([]string, 0, len(args))
+	for _, arg := range args {
+		strArgs = append(strArgs, argString(arg))
+	}
+	reply, err := s.exec(strArgs)
+	return goReply(reply), err
+}
+
+// TTL 获取 key 剩余的过期时间，key 不存在时返回 -2，未设置过期时间时返回 -1
+func (s *Store) TTL(key string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.lookup(key)
+	switch {
+	case e == nil:
+		return -2
+	case e.expireAt.IsZero():
+		return -1
+	default:
+		return e.expireAt.Sub(s.now())
+	}
+}
+
+func (s *Store) SAdd(ctx context.Context, key, val string) (int, error) {
+	reply, err := s.Do(ctx, "SADD", key, val)
+	if err != nil {
+		return -1, err
+	}
+	return int(reply.(int64)), nil
+}
+
+// Eval 执行 lua 脚本，并缓存脚本.
+func (s *Store) Eval(ctx context.Context, src string, keys []string, args []interface{}) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.check(ctx); err != nil {
+		return nil, err
+	}
+
+	sha, err := s.load(src)
+	if err != nil {
+		return nil, err
+	}
+	return s.run(s.scripts[sha], keys, args)
+}
+
+// EvalSha 通过 sha1 执行已缓存的 lua 脚本.
+func (s *Store) EvalSha(ctx context.Context, sha string, keys []string, args []interface{}) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.check(ctx); err != nil {
+		return nil, err
+	}
+
+	proto, ok := s.scripts[strings.ToLower(sha)]
+	if !ok {
+		return nil, errNoScript
+	}
+	return s.run(proto, keys, args)
+}
+
+// ScriptLoad 缓存 lua 脚本，返回脚本的 sha1.
+func (s *Store) ScriptLoad(ctx context.Context, src string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.check(ctx); err != nil {
+		return "", err
+	}
+	return s.load(src)
+}
+
+// Ping 检查存储是否可用.
+func (s *Store) Ping(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.check(ctx)
+}
+
+// Close 关闭存储，关闭后的调用均返回 ErrClosed.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *Store) check(ctx context.Context) error {
+	if s.closed {
+		return ErrClosed
+	}
+	return ctx.Err()
+}
+
+func (s *Store) now() time.Time {
+	return time.Now().Add(s.offset)
+}
+
+// load 编译并缓存脚本
+func (s *Store) load(src string) (string, error) {
+	sum := sha1.Sum([]byte(src))
+	sha := hex.EncodeToString(sum[:])
+	if _, ok := s.scripts[sha]; ok {
+		return sha, nil
+	}
+
+	name := "@user_script"
+	chunk, err := parse.Parse(strings.NewReader(src), name)
+	if err != nil {
+		return "", fmt.Errorf("ERR Error compiling script: %w", err)
+	}
+	proto, err := lua.Compile(chunk, name)
+	if err != nil {
+		return "", fmt.Errorf("ERR Error compiling script: %w", err)
+	}
+	s.scripts[sha] = proto
+	return sha, nil
+}
+
+// run 在新的 lua 虚拟机中执行脚本
+func (s *Store) run(proto *lua.FunctionProto, keys []string, args []interface{}) (interface{}, error) {
+	if s.cluster && len(keys) > 1 {
+		for _, key := range keys[1:] {
+			if keyslot.Of(key) != keyslot.Of(keys[0]) {
+				return nil, errCrossSlot
+			}
+		}
+	}
+
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	defer L.Close()
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+
+	keysTable := L.CreateTable(len(keys), 0)
+	for _, key := range keys {
+		keysTable.Append(lua.LString(key))
+	}
+	L.SetGlobal("KEYS", keysTable)
+	argvTable := L.CreateTable(len(args), 0)
+	for _, arg := range args {
+		argvTable.Append(lua.LString(argString(arg)))
+	}
+	L.SetGlobal("ARGV", argvTable)
+
+	redisTable := L.NewTable()
+	L.SetFuncs(redisTable, map[string]lua.LGFunction{
+		"call":  func(L *lua.LState) int { return s.luaCall(L, true) },
+		"pcall": func(L *lua.LState) int { return s.luaCall(L, false) },
+		"error_reply": func(L *lua.LState) int {
+			reply := L.NewTable()
+			reply.RawSetString("err", lua.LString(L.CheckString(1)))
+			L.Push(reply)
+			return 1
+		},
+		"status_reply": func(L *lua.LState) int {
+			reply := L.NewTable()
+			reply.RawSetString("ok", lua.LString(L.CheckString(1)))
+			L.Push(reply)
+			return 1
+		},
+		"log": func(L *lua.LState) int { return 0 },
+	})
+	L.SetGlobal("redis", redisTable)
+
+	L.Push(L.NewFunctionFromProto(proto))
+	if err := L.PCall(0, 1, nil); err != nil {
+		return nil, fmt.Errorf("ERR Error running script: %w", err)
+	}
+	reply, err := fromLua(L.Get(-1))
+	if err != nil {
+		return nil, err
+	}
+	return goReply(reply), nil
+}
+
+// luaCall 实现 redis.call 以及 redis.pcall. raise 为 true 时命令出错抛出 lua 错误，否则返回错误表
+func (s *Store) luaCall(L *lua.LState, raise bool) int {
+	args := make([]string, 0, L.GetTop())
+	for i := 1; i <= L.GetTop(); i++ {
+		switch v := L.Get(i).(type) {
+		case lua.LString:
+			args = append(args, string(v))
+		case lua.LNumber:
+			args = append(args, formatNumber(float64(v)))
+		default:
+			L.RaiseError("Lua redis lib command arguments must be strings or integers")
+			return 0
+		}
+	}
+
+	reply, err := s.exec(args)
+	if err != nil {
+		if raise {
+			L.RaiseError("%s", err.Error())
+			return 0
+		}
+		errTable := L.NewTable()
+		errTable.RawSetString("err", lua.LString(err.Error()))
+		L.Push(errTable)
+		return 1
+	}
+	L.Push(toLua(L, reply))
+	return 1
+}
+
+// status 状态回复，例如 OK
+type status string
+
+// toLua 按照 redis 的规则将命令的返回值转换为 lua 值
+func toLua(L *lua.LState, reply interface{}) lua.LValue {
+	switch v := reply.(type) {
+	case nil:
+		return lua.LFalse
+	case int64:
+		return lua.LNumber(v)
+	case string:
+		return lua.LString(v)
+	case status:
+		t := L.NewTable()
+		t.RawSetString("ok", lua.LString(v))
+		return t
+	case []interface{}:
+		t := L.CreateTable(len(v), 0)
+		for _, item := range v {
+			t.Append(toLua(L, item))
+		}
+		return t
+	default:
+		panic(fmt.Sprintf("fake: unexpected reply type %T", reply))
+	}
+}
+
+// fromLua 按照 redis 的规则将脚本的返回值转换为命令的返回值
+// 数字截断为整数，true 转换为 1，false 转换为 nil，数组遇到 nil 时截断
+func fromLua(v lua.LValue) (interface{}, error) {
+	switch v := v.(type) {
+	case lua.LNumber:
+		return int64(v), nil
+	case lua.LString:
+		return string(v), nil
+	case lua.LBool:
+		if v {
+			return int64(1), nil
+		}
+		return nil, nil
+	case *lua.LTable:
+		if errMsg, ok := v.RawGetString("err").(lua.LString); ok {
+			return nil, errors.New(string(errMsg))
+		}
+		if ok, isStatus := v.RawGetString("ok").(lua.LString); isStatus {
+			return status(ok), nil
+		}
+		items := []interface{}{}
+		for i := 1; ; i++ {
+			item := v.RawGetInt(i)
+			if item == lua.LNil {
+				break
+			}
+			reply, err := fromLua(item)
+			if err != nil {
+				// 与 redis 一致，数组中的错误作为元素返回
+				reply = err
+			}
+			items = append(items, reply)
+		}
+		return items, nil
+	default:
+		return nil, nil
+	}
+}
+
+// goReply 将状态回复转换为字符串
+func goReply(reply interface{}) interface{} {
+	switch v := reply.(type) {
+	case status:
+		return string(v)
+	case []interface{}:
+		for i, item := range v {
+			v[i] = goReply(item)
+		}
+		return v
+	default:
+		return reply
+	}
+}
+
+// argString 将命令参数转换为字符串
+func argString(arg interface{}) string {
+	switch v := arg.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// formatNumber 与 redis 一致，lua 中的数字以 %.17g 格式转换为命令参数
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'g', 17, 64)
+}
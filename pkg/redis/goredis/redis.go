@@ -2,58 +2,170 @@ package goredis
 
 import (
 	"context"
+	"math"
 	"time"
 
 	store "github.com/dej4vu/timewheel/pkg/redis"
 	"github.com/redis/go-redis/v9"
 )
 
-var _ store.Store = (*Client)(nil)
+var _ store.ShardedStore = (*Client)(nil)
 
 // Client Redis 客户端.
+// 底层为 redis.UniversalClient，支持单节点、Cluster、Sentinel 以及 Ring 部署模式.
 type Client struct {
 	opts *store.ClientOptions
-	rdb  *redis.Client
+	rdb  redis.UniversalClient
 }
 
+// NewClient 构造单节点 Redis 客户端.
 func NewClient(network, address, password string, opts ...store.ClientOption) *Client {
 	c := Client{
-		opts: &store.ClientOptions{
-			Network:  network,
-			Address:  address,
-			Password: password,
-		},
+		opts: newClientOptions(network, address, password, opts...),
 	}
 
-	for _, opt := range opts {
-		opt(c.opts)
+	rdb := c.getCliet()
+	return NewUniversalClient(rdb)
+}
+
+// NewClusterClient 构造 Redis Cluster 客户端.
+// 时间轮在同一个 lua 脚本中访问的 key 均带有相同的 hash tag，保证落在同一个 slot.
+func NewClusterClient(addrs []string, password string, opts ...store.ClientOption) *Client {
+	c := Client{
+		opts: newClientOptions("tcp", "", password, opts...),
 	}
 
-	store.RepairClient(c.opts)
+	uopts := c.universalOptions(addrs)
+	return NewUniversalClient(redis.NewClusterClient(uopts.Cluster()))
+}
 
-	rdb := c.getCliet()
-	return &Client{
+// NewFailoverClient 构造基于 Sentinel 自动发现主节点的 Redis 客户端.
+func NewFailoverClient(masterName string, sentinelAddrs []string, password string, opts ...store.ClientOption) *Client {
+	c := Client{
+		opts: newClientOptions("tcp", "", password, opts...),
+	}
+
+	uopts := c.universalOptions(sentinelAddrs)
+	uopts.MasterName = masterName
+	return NewUniversalClient(redis.NewFailoverClient(uopts.Failover()))
+}
+
+// NewRingClient 构造 Ring 分片 Redis 客户端，addrs 为分片名称到地址的映射.
+// Ring 按照 hash tag 选择分片，时间轮在同一个 lua 脚本中访问的 key 会落在同一个分片.
+func NewRingClient(addrs map[string]string, password string, opts ...store.ClientOption) *Client {
+	c := Client{
+		opts: newClientOptions("tcp", "", password, opts...),
+	}
+
+	poolSize, poolTimeout := c.poolSettings()
+	return NewUniversalClient(redis.NewRing(&redis.RingOptions{
+		Addrs:           addrs,
+		Username:        c.opts.Username,
+		Password:        c.opts.Password,
+		DB:              c.opts.DB,
+		ClientName:      c.opts.ClientName,
+		TLSConfig:       c.opts.TLSConfig,
+		DialTimeout:     c.opts.DialTimeout,
+		ReadTimeout:     c.opts.ReadTimeout,
+		WriteTimeout:    c.opts.WriteTimeout,
+		PoolSize:        poolSize,
+		PoolTimeout:     poolTimeout,
+		MaxIdleConns:    c.opts.MaxIdle,
+		MaxActiveConns:  c.opts.MaxActive,
+		ConnMaxIdleTime: time.Duration(c.opts.IdleTimeoutSeconds) * time.Second,
+		OnConnect:       ping,
+	}))
+}
+
+// NewUniversalClient 基于已创建的 go-redis 客户端构造 Client，
+// 支持 *redis.Client、*redis.ClusterClient、*redis.Ring 等 redis.UniversalClient 实现.
+func NewUniversalClient(rdb redis.UniversalClient) *Client {
+	client := &Client{
 		rdb: rdb,
 	}
+	return client
+}
+
+func newClientOptions(network, address, password string, opts ...store.ClientOption) *store.ClientOptions {
+	c := &store.ClientOptions{
+		Network:  network,
+		Address:  address,
+		Password: password,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	store.RepairClient(c)
+	return c
 }
 
 func (c *Client) getCliet() *redis.Client {
+	poolSize, poolTimeout := c.poolSettings()
 	opt := &redis.Options{
 		Network:         c.opts.Network,
 		Addr:            c.opts.Address,
+		Username:        c.opts.Username,
 		Password:        c.opts.Password,
+		DB:              c.opts.DB,
+		ClientName:      c.opts.ClientName,
+		TLSConfig:       c.opts.TLSConfig,
+		DialTimeout:     c.opts.DialTimeout,
+		ReadTimeout:     c.opts.ReadTimeout,
+		WriteTimeout:    c.opts.WriteTimeout,
+		PoolSize:        poolSize,
+		PoolTimeout:     poolTimeout,
 		MaxIdleConns:    c.opts.MaxIdle,
 		MaxActiveConns:  c.opts.MaxActive,
-		ConnMaxIdleTime: time.Duration(c.opts.IdleTimeoutSeconds),
-		OnConnect: func(ctx context.Context, cn *redis.Conn) error {
-			err := cn.Ping(ctx).Err()
-			return err
-		},
+		ConnMaxIdleTime: time.Duration(c.opts.IdleTimeoutSeconds) * time.Second,
+		OnConnect:       ping,
 	}
 
 	return redis.NewClient(opt)
 }
 
+// universalOptions 将 ClientOptions 转换为 Cluster、Sentinel 模式通用的配置.
+func (c *Client) universalOptions(addrs []string) *redis.UniversalOptions {
+	poolSize, poolTimeout := c.poolSettings()
+	return &redis.UniversalOptions{
+		Addrs:           addrs,
+		Username:        c.opts.Username,
+		Password:        c.opts.Password,
+		DB:              c.opts.DB,
+		ClientName:      c.opts.ClientName,
+		TLSConfig:       c.opts.TLSConfig,
+		DialTimeout:     c.opts.DialTimeout,
+		ReadTimeout:     c.opts.ReadTimeout,
+		WriteTimeout:    c.opts.WriteTimeout,
+		PoolSize:        poolSize,
+		PoolTimeout:     poolTimeout,
+		MaxIdleConns:    c.opts.MaxIdle,
+		MaxActiveConns:  c.opts.MaxActive,
+		ConnMaxIdleTime: time.Duration(c.opts.IdleTimeoutSeconds) * time.Second,
+		OnConnect:       ping,
+	}
+}
+
+// poolSettings 按照 MaxActive 与 Wait 计算 go-redis 连接池的大小与等待时间.
+// go-redis 在连接数达到 PoolSize 后等待 PoolTimeout，
+// Wait 模式下一直等待直到 ctx 结束，否则连接耗尽时立即返回错误，与 redigo 的语义保持一致.
+// MaxActive 为 0 表示不限制，此时使用 go-redis 的默认值.
+func (c *Client) poolSettings() (int, time.Duration) {
+	if c.opts.MaxActive <= 0 {
+		return 0, 0
+	}
+	if c.opts.Wait {
+		return c.opts.MaxActive, time.Duration(math.MaxInt64)
+	}
+	return c.opts.MaxActive, time.Nanosecond
+}
+
+func ping(ctx context.Context, cn *redis.Conn) error {
+	err := cn.Ping(ctx).Err()
+	return err
+}
+
 func (c *Client) SAdd(ctx context.Context, key, val string) (int, error) {
 	resp, err := c.rdb.SAdd(ctx, key, val).Result()
 	return int(resp), err
@@ -64,3 +176,35 @@ func (c *Client) Eval(ctx context.Context, src string, keys []string, args []int
 	resp, err := c.rdb.Eval(ctx, src, keys, args...).Result()
 	return resp, err
 }
+
+// EvalSha 通过 sha1 执行已缓存的 lua 脚本.
+func (c *Client) EvalSha(ctx context.Context, sha string, keys []string, args []interface{}) (interface{}, error) {
+	resp, err := c.rdb.EvalSha(ctx, sha, keys, args...).Result()
+	return resp, err
+}
+
+// ScriptLoad 缓存 lua 脚本，返回脚本的 sha1.
+// Cluster、Ring 模式下会在所有节点上加载.
+func (c *Client) ScriptLoad(ctx context.Context, src string) (string, error) {
+	return c.rdb.ScriptLoad(ctx, src).Result()
+}
+
+// Ping 检查 redis 是否可用.
+func (c *Client) Ping(ctx context.Context) error {
+	return c.rdb.Ping(ctx).Err()
+}
+
+// Sharded 是否为 Cluster、Ring 等分片模式的客户端.
+func (c *Client) Sharded() bool {
+	switch c.rdb.(type) {
+	case *redis.ClusterClient, *redis.Ring:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close 关闭客户端.
+func (c *Client) Close() error {
+	return c.rdb.Close()
+}
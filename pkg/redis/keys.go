@@ -0,0 +1,86 @@
+package redis
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dej4vu/timewheel/pkg/util"
+)
+
+// 全局 key
+const (
+	// 扫描水位的 key
+	WatermarkKey = "timewheel_watermark"
+	// 死信队列 zset 的 key
+	DeadLetterKey = "timewheel_deadletter"
+	// leader 租约的 key
+	LeaderKey = "timewheel_leader_{leader}"
+	// fencing token 计数器的 key，与 leader 租约处于同一 hash tag
+	LeaderTokenKey = "timewheel_leader_token_{leader}"
+)
+
+// MinuteSliceKey 获取定时任务有序表 key 的方法
+// 同一分钟的各个 key 使用相同的 hash tag，保证在 cluster 模式下落在同一个 slot
+func MinuteSliceKey(executeAt time.Time) string {
+	return fmt.Sprintf("timewheel_task_{%s}", util.GetTimeMinuteStr(executeAt))
+}
+
+// DeleteSetKey 获取删除任务集合 key 的方法
+func DeleteSetKey(executeAt time.Time) string {
+	return fmt.Sprintf("timewheel_delset_{%s}", util.GetTimeMinuteStr(executeAt))
+}
+
+// ProcessingKey 获取处理中任务有序表 key 的方法
+func ProcessingKey(executeAt time.Time) string {
+	return fmt.Sprintf("timewheel_processing_{%s}", util.GetTimeMinuteStr(executeAt))
+}
+
+// DeliveriesKey 获取处理中任务取出次数 hash 的方法，field 为任务明细
+func DeliveriesKey(executeAt time.Time) string {
+	return fmt.Sprintf("timewheel_deliveries_{%s}", util.GetTimeMinuteStr(executeAt))
+}
+
+// TaskIndexKey key 索引 hash 的 key，field 为任务 key，value 为 执行时间的毫秒级时间戳:任务明细
+const TaskIndexKey = "timewheel_task_index"
+
+// keyspace 存储后端使用的 key
+// hashTag 为空时与 MinuteSliceKey 等函数一致，同一分钟的 key 落在同一个 slot；
+// 不为空时所有任务相关的 key 使用相同的 hash tag，在 cluster 模式下落在同一个 slot，key 索引可以与时间片在同一脚本中原子更新
+type keyspace struct {
+	hashTag string
+}
+
+func (k keyspace) minuteSlice(executeAt time.Time) string {
+	if k.hashTag == "" {
+		return MinuteSliceKey(executeAt)
+	}
+	return fmt.Sprintf("timewheel_task_{%s}_%s", k.hashTag, util.GetTimeMinuteStr(executeAt))
+}
+
+func (k keyspace) deleteSet(executeAt time.Time) string {
+	if k.hashTag == "" {
+		return DeleteSetKey(executeAt)
+	}
+	return fmt.Sprintf("timewheel_delset_{%s}_%s", k.hashTag, util.GetTimeMinuteStr(executeAt))
+}
+
+func (k keyspace) processing(executeAt time.Time) string {
+	if k.hashTag == "" {
+		return ProcessingKey(executeAt)
+	}
+	return fmt.Sprintf("timewheel_processing_{%s}_%s", k.hashTag, util.GetTimeMinuteStr(executeAt))
+}
+
+func (k keyspace) deliveries(executeAt time.Time) string {
+	if k.hashTag == "" {
+		return DeliveriesKey(executeAt)
+	}
+	return fmt.Sprintf("timewheel_deliveries_{%s}_%s", k.hashTag, util.GetTimeMinuteStr(executeAt))
+}
+
+func (k keyspace) taskIndex() string {
+	if k.hashTag == "" {
+		return TaskIndexKey
+	}
+	return fmt.Sprintf("%s_{%s}", TaskIndexKey, k.hashTag)
+}
@@ -0,0 +1,18 @@
+-- 确认任务处理完成，将任务从处理中的 zset 以及取出次数的 hash 中移除
+-- ARGV 依次为各笔任务的 key 以及 key 索引的值（执行时间的毫秒级时间戳:任务明细）
+-- 开启 key 索引时，key 索引仍然指向该任务则一并删除
+local processingKey = KEYS[1]
+local deliveriesKey = KEYS[2]
+local indexKey = KEYS[3]
+for i = 1, #ARGV, 2 do
+    local taskKey = ARGV[i]
+    local indexValue = ARGV[i + 1]
+    local sep = string.find(indexValue, ':', 1, true)
+    local task = string.sub(indexValue, sep + 1)
+    redis.call('zrem', processingKey, task)
+    redis.call('hdel', deliveriesKey, task)
+    if indexKey and redis.call('hget', indexKey, taskKey) == indexValue then
+        redis.call('hdel', indexKey, taskKey)
+    end
+end
+return redis.call('zcard', processingKey)
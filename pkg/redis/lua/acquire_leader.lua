@@ -0,0 +1,17 @@
+-- 竞选或者续期 leader 租约
+-- 租约空闲时通过 set nx px 抢占，并递增 fencing token；当前实例已持有租约时续期
+-- 返回当前实例持有的 fencing token，未持有租约时返回 0
+local leaderKey = KEYS[1]
+local tokenKey = KEYS[2]
+local id = ARGV[1]
+local ttl = ARGV[2]
+local holder = redis.call('get', leaderKey)
+if holder == id then
+    redis.call('pexpire', leaderKey, ttl)
+    return tonumber(redis.call('get', tokenKey))
+end
+if holder then
+    return 0
+end
+redis.call('set', leaderKey, id, 'nx', 'px', ttl)
+return redis.call('incr', tokenKey)
@@ -1,9 +1,33 @@
 -- 添加任务时，如果存在删除 key 的标识，则将其删除
 -- 添加任务时，根据时间（所属的 min）决定数据从属于哪个分片{}
+-- 开启 key 索引时，将 key 索引指向该任务，并将 key 索引原先指向的任务从其时间片以及处理中移除
+-- key 索引的值与调用方读取的值不一致时，说明任务已被并发修改，返回 -1 由调用方重新读取
 local zsetKey = KEYS[1]
 local deleteSetKey = KEYS[2]
+local indexKey = KEYS[3]
+-- 原任务所属的时间片、处理中的 zset 以及取出次数的 hash，key 索引不存在时为空
+local oldZsetKey = KEYS[4]
+local oldProcessingKey = KEYS[5]
+local oldDeliveriesKey = KEYS[6]
 local score = ARGV[1]
 local task = ARGV[2]
 local taskKey = ARGV[3]
+local indexValue = ARGV[4]
+-- 调用方读取的 key 索引的值，不存在时为空字符串
+local oldIndexValue = ARGV[5]
+if indexKey then
+    local current = redis.call('hget', indexKey, taskKey) or ''
+    if current ~= oldIndexValue then
+        return -1
+    end
+    if oldZsetKey then
+        local sep = string.find(oldIndexValue, ':', 1, true)
+        local oldTask = string.sub(oldIndexValue, sep + 1)
+        redis.call('zrem', oldZsetKey, oldTask)
+        redis.call('zrem', oldProcessingKey, oldTask)
+        redis.call('hdel', oldDeliveriesKey, oldTask)
+    end
+    redis.call('hset', indexKey, taskKey, indexValue)
+end
 redis.call('srem', deleteSetKey, taskKey)
 return redis.call('zadd', zsetKey, score, task)
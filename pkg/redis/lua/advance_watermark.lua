@@ -0,0 +1,9 @@
+-- 推进已扫描完成的水位，水位只增不减. 水位为毫秒级时间戳，大于历史版本记录的秒级时间戳
+local watermarkKey = KEYS[1]
+local watermark = tonumber(ARGV[1])
+local current = tonumber(redis.call('get', watermarkKey) or 0)
+if watermark > current then
+    redis.call('set', watermarkKey, watermark)
+    return watermark
+end
+return current
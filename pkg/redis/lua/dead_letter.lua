@@ -0,0 +1,5 @@
+-- 将任务转入死信队列，以失败时间的毫秒级时间戳作为 score
+local deadLetterKey = KEYS[1]
+local failedAt = ARGV[1]
+local deadLetter = ARGV[2]
+return redis.call('zadd', deadLetterKey, failedAt, deadLetter)
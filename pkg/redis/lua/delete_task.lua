@@ -1,10 +1,17 @@
 -- 删除任务
 -- 获取标识删除任务的 set 集合的 key
 local deleteSetKey = KEYS[1]
+-- 分钟级 zset 时间片
+local zsetKey = KEYS[2]
+-- key 索引，未开启时为空
+local indexKey = KEYS[3]
 -- 获取定时任务的唯一键
 local taskKey = ARGV[1]
 -- 获取定时任务距离当前时间的秒数
 local ttl = ARGV[2]
+-- 时间片的起止毫秒级时间戳，左闭右开
+local minuteStart = tonumber(ARGV[3])
+local minuteEnd = tonumber(ARGV[4])
 -- 将定时任务唯一键添加到 set 中
 redis.call('sadd', deleteSetKey, taskKey)
 local scnt = redis.call('scard', deleteSetKey)
@@ -12,4 +19,17 @@ local scnt = redis.call('scard', deleteSetKey)
 if (tonumber(scnt) == 1) then
     redis.call('expire', deleteSetKey, ttl)
 end
+-- key 索引指向该时间片内的任务时一并删除，并将任务从时间片中移除
+-- 否则之后在同一时间片内重新添加该 key 时清除了删除标识，原任务会与新任务一同被取出执行
+if indexKey then
+    local indexValue = redis.call('hget', indexKey, taskKey)
+    if indexValue then
+        local executeAt, task = string.match(indexValue, '^(%d+):(.*)$')
+        executeAt = tonumber(executeAt)
+        if executeAt and executeAt >= minuteStart and executeAt < minuteEnd then
+            redis.call('hdel', indexKey, taskKey)
+            redis.call('zrem', zsetKey, task)
+        end
+    end
+end
 return scnt
@@ -0,0 +1,7 @@
+-- 获取已扫描完成的水位，不存在时返回 0
+local watermarkKey = KEYS[1]
+local watermark = redis.call('get', watermarkKey)
+if not watermark then
+    return 0
+end
+return tonumber(watermark)
@@ -0,0 +1,8 @@
+-- 通过 key 索引获取任务，返回 执行时间的毫秒级时间戳:任务明细，不存在时返回空字符串
+local indexKey = KEYS[1]
+local taskKey = ARGV[1]
+local value = redis.call('hget', indexKey, taskKey)
+if not value then
+    return ''
+end
+return value
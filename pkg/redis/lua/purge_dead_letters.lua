@@ -0,0 +1,4 @@
+-- 清理失败时间早于指定时刻的死信
+local deadLetterKey = KEYS[1]
+local before = ARGV[1]
+return redis.call('zremrangebyscore', deadLetterKey, '-inf', before)
@@ -0,0 +1,5 @@
+-- 按照失败时间顺序分页获取死信
+local deadLetterKey = KEYS[1]
+local start = ARGV[1]
+local stop = ARGV[2]
+return redis.call('zrange', deadLetterKey, start, stop)
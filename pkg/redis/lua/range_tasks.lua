@@ -1,15 +1,40 @@
 -- 扫描 redis 时间轮. 获取分钟范围内,已删除任务集合 以及在时间上达到执行条件的定时任务进行返回
+-- 达到执行条件的任务不会直接删除，而是转移到处理中的 zset，以租约到期时间作为 score，任务处理成功后再执行 ack
+-- 取出次数记录在处理中任务的 hash 中，首次取出记为 1
+-- 处理中的 zset 以及 hash 在最近一次租约到期之后 ttl 毫秒过期，避免未确认的任务一直残留
+-- 单次最多取出 limit 笔任务，避免补偿扫描时一次性取出过多任务
+-- 任务以毫秒级时间戳作为 score，同时兼容以秒级时间戳作为 score 的历史任务
 -- 当聚合类型为空时，会自动被 redis 删除
 local zsetKey = KEYS[1]
 local deleteSetKey = KEYS[2]
+local processingKey = KEYS[3]
+local deliveriesKey = KEYS[4]
 local score1 = ARGV[1]
 local score2 = ARGV[2]
+local leaseDeadline = ARGV[3]
+local limit = tonumber(ARGV[4])
+local legacyScore1 = ARGV[5]
+local legacyScore2 = ARGV[6]
+local ttl = tonumber(ARGV[7])
 local deleteSet = redis.call('smembers', deleteSetKey)
-local targets = redis.call('zrange', zsetKey, score1, score2, 'byscore')
-redis.call('zremrangebyscore', zsetKey, score1, score2)
+local targets = redis.call('zrange', zsetKey, legacyScore1, legacyScore2, 'byscore', 'limit', 0, limit)
+if #targets < limit then
+    local msTargets = redis.call('zrange', zsetKey, score1, score2, 'byscore', 'limit', 0, limit - #targets)
+    for i, v in ipairs(msTargets) do
+        targets[#targets + 1] = v
+    end
+end
 local reply = {}
 reply[1] = deleteSet
 for i, v in ipairs(targets) do
+    redis.call('zrem', zsetKey, v)
+    redis.call('zadd', processingKey, leaseDeadline, v)
+    redis.call('hset', deliveriesKey, v, 1)
     reply[#reply + 1] = v
 end
+-- 只延长不缩短过期时间
+if #targets > 0 and redis.call('pttl', processingKey) < ttl then
+    redis.call('pexpire', processingKey, ttl)
+    redis.call('pexpire', deliveriesKey, ttl)
+end
 return reply
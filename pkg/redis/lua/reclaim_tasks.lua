@@ -0,0 +1,23 @@
+-- 回收租约已过期的任务. 以新的租约到期时间重新占有任务，并将取出次数加 1
+-- 返回已删除任务集合，随后依次为各笔回收的任务以及其取出次数
+local processingKey = KEYS[1]
+local deleteSetKey = KEYS[2]
+local deliveriesKey = KEYS[3]
+local now = ARGV[1]
+local leaseDeadline = ARGV[2]
+local limit = ARGV[3]
+local ttl = tonumber(ARGV[4])
+local targets = redis.call('zrange', processingKey, '-inf', now, 'byscore', 'limit', 0, limit)
+local reply = {}
+reply[1] = redis.call('smembers', deleteSetKey)
+for i, v in ipairs(targets) do
+    redis.call('zadd', processingKey, leaseDeadline, v)
+    reply[#reply + 1] = v
+    reply[#reply + 1] = redis.call('hincrby', deliveriesKey, v, 1)
+end
+-- 只延长不缩短过期时间
+if #targets > 0 and redis.call('pttl', processingKey) < ttl then
+    redis.call('pexpire', processingKey, ttl)
+    redis.call('pexpire', deliveriesKey, ttl)
+end
+return reply
@@ -0,0 +1,7 @@
+-- 释放当前实例持有的 leader 租约
+local leaderKey = KEYS[1]
+local id = ARGV[1]
+if redis.call('get', leaderKey) == id then
+    return redis.call('del', leaderKey)
+end
+return 0
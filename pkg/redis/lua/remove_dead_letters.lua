@@ -0,0 +1,7 @@
+-- 从死信队列中删除指定的死信
+local deadLetterKey = KEYS[1]
+local cnt = 0
+for i, v in ipairs(ARGV) do
+    cnt = cnt + redis.call('zrem', deadLetterKey, v)
+end
+return cnt
@@ -0,0 +1,20 @@
+-- 通过 key 索引删除任务
+-- key 索引的值与调用方读取的值不一致时，说明任务已被并发修改，返回 0 由调用方重新读取
+local indexKey = KEYS[1]
+local zsetKey = KEYS[2]
+local deleteSetKey = KEYS[3]
+local taskKey = ARGV[1]
+local indexValue = ARGV[2]
+local task = ARGV[3]
+local ttl = ARGV[4]
+if redis.call('hget', indexKey, taskKey) ~= indexValue then
+    return 0
+end
+redis.call('hdel', indexKey, taskKey)
+-- 从待执行的任务中移除，已被取出的任务通过删除标识跳过
+redis.call('zrem', zsetKey, task)
+redis.call('sadd', deleteSetKey, taskKey)
+if (tonumber(redis.call('scard', deleteSetKey)) == 1) then
+    redis.call('expire', deleteSetKey, ttl)
+end
+return 1
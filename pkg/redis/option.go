@@ -1,5 +1,10 @@
 package redis
 
+import (
+	"crypto/tls"
+	"time"
+)
+
 const (
 	// 默认连接池超过 10 s 释放连接
 	DefaultIdleTimeoutSeconds = 10
@@ -15,6 +20,16 @@ type ClientOptions struct {
 	MaxActive          int
 	Wait               bool
 	DB                 int
+	// ACL 用户名，为空时仅使用密码认证
+	Username string
+	// 非空时使用 TLS 建立连接
+	TLSConfig *tls.Config
+	// 建立连接、读、写超时，为 0 时使用客户端库的默认值
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// 连接建立后通过 CLIENT SETNAME 设置的连接名称
+	ClientName string
 	// 必填参数
 	Network  string
 	Address  string
@@ -53,6 +68,42 @@ func WithDB(db int) ClientOption {
 	}
 }
 
+func WithUsername(username string) ClientOption {
+	return func(c *ClientOptions) {
+		c.Username = username
+	}
+}
+
+func WithTLSConfig(config *tls.Config) ClientOption {
+	return func(c *ClientOptions) {
+		c.TLSConfig = config
+	}
+}
+
+func WithDialTimeout(timeout time.Duration) ClientOption {
+	return func(c *ClientOptions) {
+		c.DialTimeout = timeout
+	}
+}
+
+func WithReadTimeout(timeout time.Duration) ClientOption {
+	return func(c *ClientOptions) {
+		c.ReadTimeout = timeout
+	}
+}
+
+func WithWriteTimeout(timeout time.Duration) ClientOption {
+	return func(c *ClientOptions) {
+		c.WriteTimeout = timeout
+	}
+}
+
+func WithClientName(name string) ClientOption {
+	return func(c *ClientOptions) {
+		c.ClientName = name
+	}
+}
+
 func RepairClient(c *ClientOptions) {
 	if c.MaxIdle < 0 {
 		c.MaxIdle = DefaultMaxIdle
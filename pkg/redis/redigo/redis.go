@@ -32,9 +32,11 @@ func NewClient(network, address, password string, opts ...store.ClientOption) *C
 	store.RepairClient(c.opts)
 
 	pool := c.getRedisPool()
-	return &Client{
+	client := &Client{
+		opts: c.opts,
 		pool: pool,
 	}
+	return client
 }
 
 func (c *Client) getRedisPool() *redis.Pool {
@@ -66,18 +68,51 @@ func (c *Client) getRedisConn() (redis.Conn, error) {
 		panic("Cannot get redis address from config")
 	}
 
-	var dialOpts []redis.DialOption
-	if len(c.opts.Password) > 0 {
-		dialOpts = append(dialOpts, redis.DialPassword(c.opts.Password))
-	}
 	conn, err := redis.DialContext(context.Background(),
-		c.opts.Network, c.opts.Address, dialOpts...)
+		c.opts.Network, c.opts.Address, c.dialOptions()...)
 	if err != nil {
 		return nil, err
 	}
 	return conn, nil
 }
 
+// dialOptions 将 ClientOptions 转换为建立连接时的参数.
+func (c *Client) dialOptions() []redis.DialOption {
+	dialOpts := []redis.DialOption{
+		redis.DialDatabase(c.opts.DB),
+	}
+	if len(c.opts.Username) > 0 {
+		dialOpts = append(dialOpts, redis.DialUsername(c.opts.Username))
+	}
+	if len(c.opts.Password) > 0 {
+		dialOpts = append(dialOpts, redis.DialPassword(c.opts.Password))
+	}
+	if len(c.opts.ClientName) > 0 {
+		dialOpts = append(dialOpts, redis.DialClientName(c.opts.ClientName))
+	}
+	return append(dialOpts, c.transportOptions()...)
+}
+
+// transportOptions 返回 TLS 与超时相关的连接参数，同样适用于连接 sentinel.
+func (c *Client) transportOptions() []redis.DialOption {
+	var dialOpts []redis.DialOption
+	if c.opts.TLSConfig != nil {
+		dialOpts = append(dialOpts,
+			redis.DialUseTLS(true),
+			redis.DialTLSConfig(c.opts.TLSConfig))
+	}
+	if c.opts.DialTimeout > 0 {
+		dialOpts = append(dialOpts, redis.DialConnectTimeout(c.opts.DialTimeout))
+	}
+	if c.opts.ReadTimeout > 0 {
+		dialOpts = append(dialOpts, redis.DialReadTimeout(c.opts.ReadTimeout))
+	}
+	if c.opts.WriteTimeout > 0 {
+		dialOpts = append(dialOpts, redis.DialWriteTimeout(c.opts.WriteTimeout))
+	}
+	return dialOpts
+}
+
 func (c *Client) SAdd(ctx context.Context, key, val string) (int, error) {
 	conn, err := c.pool.GetContext(ctx)
 	if err != nil {
@@ -89,8 +124,43 @@ func (c *Client) SAdd(ctx context.Context, key, val string) (int, error) {
 
 // Eval 支持使用 lua 脚本.
 func (c *Client) Eval(ctx context.Context, src string, keys []string, args []interface{}) (interface{}, error) {
+	return c.eval(ctx, "EVAL", src, keys, args)
+}
+
+// EvalSha 通过 sha1 执行已缓存的 lua 脚本.
+func (c *Client) EvalSha(ctx context.Context, sha string, keys []string, args []interface{}) (interface{}, error) {
+	return c.eval(ctx, "EVALSHA", sha, keys, args)
+}
+
+// ScriptLoad 缓存 lua 脚本，返回脚本的 sha1.
+func (c *Client) ScriptLoad(ctx context.Context, src string) (string, error) {
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	return redis.String(conn.Do("SCRIPT", "LOAD", src))
+}
+
+// Ping 检查 redis 是否可用.
+func (c *Client) Ping(ctx context.Context) error {
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Do("PING")
+	return err
+}
+
+// Close 关闭连接池.
+func (c *Client) Close() error {
+	return c.pool.Close()
+}
+
+func (c *Client) eval(ctx context.Context, cmd, script string, keys []string, args []interface{}) (interface{}, error) {
 	rargs := make([]interface{}, 2, 2+len(keys)+len(args))
-	rargs[0] = src
+	rargs[0] = script
 	rargs[1] = len(keys)
 	for _, k := range keys {
 		rargs = append(rargs, k)
@@ -103,5 +173,5 @@ func (c *Client) Eval(ctx context.Context, src string, keys []string, args []int
 	}
 	defer conn.Close()
 
-	return conn.Do("EVAL", rargs...)
+	return conn.Do(cmd, rargs...)
 }
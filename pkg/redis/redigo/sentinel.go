@@ -0,0 +1,101 @@
+package redigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	store "github.com/dej4vu/timewheel/pkg/redis"
+	"github.com/gomodule/redigo/redis"
+)
+
+// ErrNoMaster 所有 sentinel 均无法给出可用的主节点地址.
+var ErrNoMaster = errors.New("redigo: no master found from sentinels")
+
+// NewSentinelClient 构造基于 Sentinel 自动发现主节点的 Redis 客户端.
+// 每次新建连接时都会向 sentinel 查询当前主节点地址，借出连接时校验其角色仍为 master，
+// 因此主从切换后连接池会自动切换到新的主节点.
+func NewSentinelClient(masterName string, sentinelAddrs []string, password string, opts ...store.ClientOption) *Client {
+	c := Client{
+		opts: &store.ClientOptions{
+			Network:  "tcp",
+			Password: password,
+		},
+	}
+
+	for _, opt := range opts {
+		opt(c.opts)
+	}
+
+	store.RepairClient(c.opts)
+
+	pool := c.getRedisPool()
+	pool.Dial = func() (redis.Conn, error) {
+		addr, err := masterAddr(masterName, sentinelAddrs, c.transportOptions())
+		if err != nil {
+			return nil, err
+		}
+		return redis.DialContext(context.Background(), c.opts.Network, addr, c.dialOptions()...)
+	}
+	pool.TestOnBorrow = func(conn redis.Conn, t time.Time) error {
+		if !isMaster(conn) {
+			return errors.New("redigo: connection is not to master")
+		}
+		return nil
+	}
+
+	client := &Client{
+		opts: c.opts,
+		pool: pool,
+	}
+	return client
+}
+
+// masterAddr 依次询问 sentinel，返回第一个得到的主节点地址.
+func masterAddr(masterName string, sentinelAddrs []string, dialOpts []redis.DialOption) (string, error) {
+	errs := []error{ErrNoMaster}
+	for _, sentinelAddr := range sentinelAddrs {
+		addr, err := queryMaster(masterName, sentinelAddr, dialOpts)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		return addr, nil
+	}
+	return "", errors.Join(errs...)
+}
+
+func queryMaster(masterName, sentinelAddr string, dialOpts []redis.DialOption) (string, error) {
+	// 默认超时放在前面，可被 ClientOptions 中的超时覆盖
+	dialOpts = append([]redis.DialOption{
+		redis.DialConnectTimeout(time.Second),
+		redis.DialReadTimeout(time.Second),
+		redis.DialWriteTimeout(time.Second),
+	}, dialOpts...)
+	conn, err := redis.Dial("tcp", sentinelAddr, dialOpts...)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	reply, err := redis.Strings(conn.Do("SENTINEL", "get-master-addr-by-name", masterName))
+	if err != nil {
+		return "", fmt.Errorf("sentinel %s: %w", sentinelAddr, err)
+	}
+	if len(reply) != 2 {
+		return "", fmt.Errorf("sentinel %s: unexpected reply %v", sentinelAddr, reply)
+	}
+	return net.JoinHostPort(reply[0], reply[1]), nil
+}
+
+// isMaster 通过 ROLE 命令判断连接的节点是否为主节点.
+func isMaster(conn redis.Conn) bool {
+	reply, err := redis.Values(conn.Do("ROLE"))
+	if err != nil || len(reply) == 0 {
+		return false
+	}
+	role, err := redis.String(reply[0], nil)
+	return err == nil && role == "master"
+}
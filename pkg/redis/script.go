@@ -1,7 +1,11 @@
 package redis
 
 import (
+	"context"
+	"crypto/sha1"
 	_ "embed"
+	"encoding/hex"
+	"strings"
 )
 
 var (
@@ -18,4 +22,143 @@ var (
 	// 取任务 lua 脚本
 	//go:embed lua/range_tasks.lua
 	RangeTasksLuaScript string
+
+	// 获取扫描水位 lua 脚本
+	//go:embed lua/get_watermark.lua
+	GetWatermarkLuaScript string
+
+	// 推进扫描水位 lua 脚本
+	//go:embed lua/advance_watermark.lua
+	AdvanceWatermarkLuaScript string
+
+	// 确认任务处理完成 lua 脚本
+	//go:embed lua/ack_tasks.lua
+	AckTasksLuaScript string
+
+	// 回收租约过期任务 lua 脚本
+	//go:embed lua/reclaim_tasks.lua
+	ReclaimTasksLuaScript string
+
+	// 竞选或者续期 leader 租约 lua 脚本
+	//go:embed lua/acquire_leader.lua
+	AcquireLeaderLuaScript string
+
+	// 释放 leader 租约 lua 脚本
+	//go:embed lua/release_leader.lua
+	ReleaseLeaderLuaScript string
+
+	// 任务转入死信队列 lua 脚本
+	//go:embed lua/dead_letter.lua
+	DeadLetterLuaScript string
+
+	// 分页获取死信 lua 脚本
+	//go:embed lua/range_dead_letters.lua
+	RangeDeadLettersLuaScript string
+
+	// 删除死信 lua 脚本
+	//go:embed lua/remove_dead_letters.lua
+	RemoveDeadLettersLuaScript string
+
+	// 清理死信 lua 脚本
+	//go:embed lua/purge_dead_letters.lua
+	PurgeDeadLettersLuaScript string
+
+	// 通过 key 索引获取任务 lua 脚本
+	//go:embed lua/lookup_task.lua
+	LookupTaskLuaScript string
+
+	// 通过 key 索引删除任务 lua 脚本
+	//go:embed lua/remove_key.lua
+	RemoveKeyLuaScript string
 )
+
+// 预先计算 sha1 的 lua 脚本对象，通过 EVALSHA 执行
+var (
+	AddTaskScript           = NewScript(AddTaskLuaScript)
+	DeleteTaskScript        = NewScript(DeleteTaskLuaScript)
+	RangeTasksScript        = NewScript(RangeTasksLuaScript)
+	GetWatermarkScript      = NewScript(GetWatermarkLuaScript)
+	AdvanceWatermarkScript  = NewScript(AdvanceWatermarkLuaScript)
+	AckTasksScript          = NewScript(AckTasksLuaScript)
+	ReclaimTasksScript      = NewScript(ReclaimTasksLuaScript)
+	AcquireLeaderScript     = NewScript(AcquireLeaderLuaScript)
+	ReleaseLeaderScript     = NewScript(ReleaseLeaderLuaScript)
+	DeadLetterScript        = NewScript(DeadLetterLuaScript)
+	RangeDeadLettersScript  = NewScript(RangeDeadLettersLuaScript)
+	RemoveDeadLettersScript = NewScript(RemoveDeadLettersLuaScript)
+	PurgeDeadLettersScript  = NewScript(PurgeDeadLettersLuaScript)
+	LookupTaskScript        = NewScript(LookupTaskLuaScript)
+	RemoveKeyScript         = NewScript(RemoveKeyLuaScript)
+)
+
+// Scripts 返回时间轮使用的全部 lua 脚本，用于预加载
+func Scripts() []*Script {
+	return []*Script{
+		AddTaskScript,
+		DeleteTaskScript,
+		RangeTasksScript,
+		GetWatermarkScript,
+		AdvanceWatermarkScript,
+		AckTasksScript,
+		ReclaimTasksScript,
+		AcquireLeaderScript,
+		ReleaseLeaderScript,
+		DeadLetterScript,
+		RangeDeadLettersScript,
+		RemoveDeadLettersScript,
+		PurgeDeadLettersScript,
+		LookupTaskScript,
+		RemoveKeyScript,
+	}
+}
+
+// Script 预先计算 sha1 的 lua 脚本
+type Script struct {
+	src string
+	sha string
+}
+
+// NewScript 创建 lua 脚本，并预先计算其 sha1
+func NewScript(src string) *Script {
+	sum := sha1.Sum([]byte(src))
+	return &Script{
+		src: src,
+		sha: hex.EncodeToString(sum[:]),
+	}
+}
+
+// Src 脚本内容
+func (s *Script) Src() string {
+	return s.src
+}
+
+// Hash 脚本内容的 sha1
+func (s *Script) Hash() string {
+	return s.sha
+}
+
+// Run 优先通过 EVALSHA 执行脚本，redis 中尚未缓存该脚本时透明地回退到 EVAL
+// EVAL 执行后 redis 会缓存脚本，后续调用均可通过 EVALSHA 完成
+func (s *Script) Run(ctx context.Context, store Store, keys []string, args []interface{}) (interface{}, error) {
+	reply, err := store.EvalSha(ctx, s.sha, keys, args)
+	if IsNoScript(err) {
+		return store.Eval(ctx, s.src, keys, args)
+	}
+	return reply, err
+}
+
+// IsNoScript 判断错误是否为 redis 中不存在对应脚本
+func IsNoScript(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT")
+}
+
+// LoadScripts 将时间轮使用的全部 lua 脚本预加载到 redis 中
+// 客户端不会自动预加载，脚本首次执行时通过 EVAL 回退写入 redis 的脚本缓存，需要预热时可以显式调用
+func LoadScripts(ctx context.Context, store Store) error {
+	for _, script := range Scripts() {
+		if _, err := store.ScriptLoad(ctx, script.src); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -10,4 +10,32 @@ type Store interface {
 	// redis EVAL 命令格式： EVAL script numkeys [key [key ...]] [arg [arg ...]]
 	// numkeys 参数通过len(keys) 自动计算
 	Eval(ctx context.Context, src string, keys []string, args []interface{}) (interface{}, error)
+
+	// redis EVALSHA 命令格式： EVALSHA sha1 numkeys [key [key ...]] [arg [arg ...]]
+	// redis 中不存在对应脚本时，返回以 NOSCRIPT 开头的错误
+	EvalSha(ctx context.Context, sha string, keys []string, args []interface{}) (interface{}, error)
+
+	// redis SCRIPT LOAD 命令格式： SCRIPT LOAD script，返回脚本的 sha1
+	ScriptLoad(ctx context.Context, src string) (string, error)
+
+	// redis PING 命令，用于检查 redis 是否可用
+	Ping(ctx context.Context) error
+
+	// 关闭客户端，释放连接池中的全部连接
+	Close() error
+}
+
+// ShardedStore key 分散在多个节点的 Store，例如 redis cluster、Ring 客户端
+// 同一个 lua 脚本访问的 key 需要落在同一个节点
+type ShardedStore interface {
+	Store
+
+	// 是否以分片模式部署
+	Sharded() bool
+}
+
+// isSharded store 是否以分片模式部署
+func isSharded(store Store) bool {
+	sharded, ok := store.(ShardedStore)
+	return ok && sharded.Sharded()
 }
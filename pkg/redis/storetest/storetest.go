@@ -0,0 +1,339 @@
+// Package storetest 提供 redis.Store 实现的一致性测试
+//
+// 时间轮通过 gocast 解析 lua 脚本的返回值，Store 的实现需要以 int64、string（或 []byte）以及 []interface{} 表示整数、字符串以及数组.
+package storetest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dej4vu/timewheel/pkg/redis"
+	"github.com/demdxx/gocast"
+)
+
+// Factory 为每个测试用例构造一个不包含任何数据的 Store
+type Factory func(t *testing.T) redis.Store
+
+// Run 对 Store 的实现执行一致性测试
+func Run(t *testing.T, factory Factory) {
+	for _, tc := range []struct {
+		name string
+		test func(t *testing.T, store redis.Store)
+	}{
+		{"SAdd", testSAdd},
+		{"ReplyShapes", testReplyShapes},
+		{"EvalSha", testEvalSha},
+		{"AddAndRange", testAddAndRange},
+		{"Remove", testRemove},
+		{"ReAddAfterRemove", testReAddAfterRemove},
+		{"TTL", testTTL},
+		{"Concurrency", testConcurrency},
+		{"PingAndClose", testPingAndClose},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, factory(t))
+		})
+	}
+}
+
+func testSAdd(t *testing.T, store redis.Store) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		val  string
+		want int
+	}{{"a", 1}, {"b", 1}, {"a", 0}} {
+		if n, err := store.SAdd(ctx, "storetest_set", tc.val); err != nil || n != tc.want {
+			t.Errorf("sadd %s = %d, %v, want %d", tc.val, n, err, tc.want)
+		}
+	}
+	reply, err := store.Eval(ctx, "return redis.call('scard', KEYS[1])", []string{"storetest_set"}, nil)
+	if err != nil || gocast.ToInt(reply) != 2 {
+		t.Errorf("scard = %v, %v, want 2", reply, err)
+	}
+}
+
+// testReplyShapes 脚本返回值的结构需要能够被 gocast 解析
+func testReplyShapes(t *testing.T, store redis.Store) {
+	ctx := context.Background()
+
+	reply, err := store.Eval(ctx, "return 42", nil, nil)
+	if err != nil || gocast.ToInt64(reply) != 42 {
+		t.Errorf("integer reply = %#v, %v", reply, err)
+	}
+	// lua 中的小数截断为整数
+	if reply, err = store.Eval(ctx, "return 3.7", nil, nil); err != nil || gocast.ToInt64(reply) != 3 {
+		t.Errorf("float reply = %#v, %v", reply, err)
+	}
+	// 超过 32 位的整数不能丢失精度
+	if reply, err = store.Eval(ctx, "return tonumber(ARGV[1])", nil, []interface{}{int64(1700000000123)}); err != nil ||
+		gocast.ToInt64(reply) != 1700000000123 {
+		t.Errorf("int64 reply = %#v, %v", reply, err)
+	}
+	if reply, err = store.Eval(ctx, "return ARGV[1]", nil, []interface{}{"hello"}); err != nil || gocast.ToString(reply) != "hello" {
+		t.Errorf("string reply = %#v, %v", reply, err)
+	}
+
+	// 与 range_tasks 脚本一致的嵌套数组：首个元素为集合，后续元素为字符串
+	reply, err = store.Eval(ctx, `
+redis.call('sadd', KEYS[1], 'x', 'y')
+local reply = {}
+reply[1] = redis.call('smembers', KEYS[1])
+reply[2] = 'a'
+reply[3] = 'b'
+return reply`, []string{"storetest_nested"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replies := gocast.ToInterfaceSlice(reply)
+	if len(replies) != 3 {
+		t.Fatalf("nested reply = %#v, want 3 elements", reply)
+	}
+	members := gocast.ToStringSlice(replies[0])
+	sort.Strings(members)
+	if !reflect.DeepEqual(members, []string{"x", "y"}) {
+		t.Errorf("nested set = %#v, want [x y]", replies[0])
+	}
+	if gocast.ToString(replies[1]) != "a" || gocast.ToString(replies[2]) != "b" {
+		t.Errorf("nested strings = %#v, want a b", replies[1:])
+	}
+
+	// 空集合返回空数组
+	reply, err = store.Eval(ctx, "local reply = {}; reply[1] = redis.call('smembers', KEYS[1]); return reply",
+		[]string{"storetest_empty"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replies := gocast.ToInterfaceSlice(reply); len(replies) != 1 || len(gocast.ToStringSlice(replies[0])) != 0 {
+		t.Errorf("empty nested reply = %#v", reply)
+	}
+
+	if _, err := store.Eval(ctx, "return redis.call('incr', KEYS[1])", []string{"storetest_nested"}, nil); err == nil {
+		t.Error("command against wrong type should fail")
+	}
+}
+
+func testEvalSha(t *testing.T, store redis.Store) {
+	ctx := context.Background()
+	want := fmt.Sprintf("storetest %d", time.Now().UnixNano())
+	script := redis.NewScript(fmt.Sprintf("return '%s'", want))
+
+	if _, err := store.EvalSha(ctx, script.Hash(), nil, nil); !redis.IsNoScript(err) {
+		t.Fatalf("evalsha unknown script err = %v, want NOSCRIPT", err)
+	}
+	sha, err := store.ScriptLoad(ctx, script.Src())
+	if err != nil || sha != script.Hash() {
+		t.Fatalf("script load = %s, %v, want %s", sha, err, script.Hash())
+	}
+	if reply, err := store.EvalSha(ctx, sha, nil, nil); err != nil || gocast.ToString(reply) != want {
+		t.Errorf("evalsha = %#v, %v", reply, err)
+	}
+	if err := redis.LoadScripts(ctx, store); err != nil {
+		t.Errorf("load scripts: %v", err)
+	}
+}
+
+// scriptTest 通过内嵌的 lua 脚本操作一个分钟级时间片
+type scriptTest struct {
+	t      *testing.T
+	store  redis.Store
+	minute time.Time
+}
+
+func newScriptTest(t *testing.T, store redis.Store) *scriptTest {
+	return &scriptTest{t: t, store: store, minute: time.Now().Add(time.Hour).Truncate(time.Minute)}
+}
+
+func (s *scriptTest) add(key string, offset time.Duration) {
+	s.t.Helper()
+	if err := s.tryAdd(key, offset); err != nil {
+		s.t.Fatalf("add %s: %v", key, err)
+	}
+}
+
+func (s *scriptTest) tryAdd(key string, offset time.Duration) error {
+	at := s.minute.Add(offset)
+	_, err := redis.AddTaskScript.Run(context.Background(), s.store,
+		[]string{redis.MinuteSliceKey(at), redis.DeleteSetKey(at)},
+		[]interface{}{at.UnixMilli(), key, key},
+	)
+	return err
+}
+
+func (s *scriptTest) remove(key string, ttl int) {
+	s.t.Helper()
+	if _, err := redis.DeleteTaskScript.Run(context.Background(), s.store,
+		[]string{redis.DeleteSetKey(s.minute)},
+		[]interface{}{key, ttl},
+	); err != nil {
+		s.t.Fatalf("remove %s: %v", key, err)
+	}
+}
+
+// rangeTasks 与时间轮一致地解析 range_tasks 脚本的返回值
+func (s *scriptTest) rangeTasks(limit int) (deleted, tasks []string) {
+	s.t.Helper()
+	deleted, tasks, err := s.tryRangeTasks(limit)
+	if err != nil {
+		s.t.Fatalf("range tasks: %v", err)
+	}
+	return deleted, tasks
+}
+
+func (s *scriptTest) tryRangeTasks(limit int) (deleted, tasks []string, err error) {
+	from, to := s.minute.Add(-time.Millisecond), s.minute.Add(time.Minute)
+	reply, err := redis.RangeTasksScript.Run(context.Background(), s.store,
+		[]string{redis.MinuteSliceKey(s.minute), redis.DeleteSetKey(s.minute), redis.ProcessingKey(s.minute), redis.DeliveriesKey(s.minute)},
+		[]interface{}{fmt.Sprintf("(%d", from.UnixMilli()), to.UnixMilli(), time.Now().Add(time.Minute).UnixMilli(), limit,
+			fmt.Sprintf("(%d", from.Unix()), to.Unix(), time.Hour.Milliseconds()},
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	replies := gocast.ToInterfaceSlice(reply)
+	if len(replies) == 0 {
+		return nil, nil, fmt.Errorf("invalid range reply: %#v", reply)
+	}
+	deleted = gocast.ToStringSlice(replies[0])
+	sort.Strings(deleted)
+	for _, task := range replies[1:] {
+		tasks = append(tasks, gocast.ToString(task))
+	}
+	return deleted, tasks, nil
+}
+
+func assertStrings(t *testing.T, name string, got []string, want ...string) {
+	t.Helper()
+	if len(got) == 0 && len(want) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s = %v, want %v", name, got, want)
+	}
+}
+
+func testAddAndRange(t *testing.T, store redis.Store) {
+	s := newScriptTest(t, store)
+	s.add("c", 3*time.Second)
+	s.add("a", time.Second)
+	s.add("b", 2*time.Second)
+
+	deleted, tasks := s.rangeTasks(2)
+	assertStrings(t, "deleted", deleted)
+	assertStrings(t, "tasks", tasks, "a", "b")
+
+	_, tasks = s.rangeTasks(10)
+	assertStrings(t, "tasks", tasks, "c")
+	_, tasks = s.rangeTasks(10)
+	assertStrings(t, "tasks", tasks)
+}
+
+func testRemove(t *testing.T, store redis.Store) {
+	s := newScriptTest(t, store)
+	s.add("a", time.Second)
+	s.add("b", 2*time.Second)
+	s.remove("a", 3600)
+	s.remove("b", 3600)
+
+	deleted, tasks := s.rangeTasks(10)
+	assertStrings(t, "deleted", deleted, "a", "b")
+	assertStrings(t, "tasks", tasks, "a", "b")
+}
+
+func testReAddAfterRemove(t *testing.T, store redis.Store) {
+	s := newScriptTest(t, store)
+	s.add("a", time.Second)
+	s.add("b", 2*time.Second)
+	s.remove("a", 3600)
+	s.remove("b", 3600)
+	s.add("a", 3*time.Second)
+
+	deleted, tasks := s.rangeTasks(10)
+	assertStrings(t, "deleted", deleted, "b")
+	assertStrings(t, "tasks", tasks, "b", "a")
+}
+
+// testTTL 删除集合在过期后不再生效
+func testTTL(t *testing.T, store redis.Store) {
+	s := newScriptTest(t, store)
+	s.remove("a", 1)
+	s.add("b", time.Second)
+
+	deleted, _ := s.rangeTasks(0)
+	assertStrings(t, "deleted", deleted, "a")
+
+	<-time.After(2100 * time.Millisecond)
+	deleted, tasks := s.rangeTasks(10)
+	assertStrings(t, "deleted", deleted)
+	assertStrings(t, "tasks", tasks, "b")
+}
+
+// testConcurrency 并发执行脚本时，每笔任务只会被取出一次
+func testConcurrency(t *testing.T, store redis.Store) {
+	s := newScriptTest(t, store)
+	const n = 200
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := s.tryAdd(fmt.Sprintf("task%03d", i), time.Duration(i)*time.Millisecond); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var (
+		mu      sync.Mutex
+		claimed = make(map[string]int)
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				_, tasks, err := s.tryRangeTasks(7)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if len(tasks) == 0 {
+					return
+				}
+				mu.Lock()
+				for _, task := range tasks {
+					claimed[task]++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(claimed) != n {
+		t.Errorf("claimed %d tasks, want %d", len(claimed), n)
+	}
+	for task, cnt := range claimed {
+		if cnt != 1 {
+			t.Errorf("task %s claimed %d times", task, cnt)
+		}
+	}
+}
+
+func testPingAndClose(t *testing.T, store redis.Store) {
+	ctx := context.Background()
+	if err := store.Ping(ctx); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if err := store.Ping(ctx); err == nil {
+		t.Error("ping after close should fail")
+	}
+}
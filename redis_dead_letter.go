@@ -0,0 +1,98 @@
+package timewheel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// DeadLetter 重试耗尽后转入死信队列的任务
+type DeadLetter struct {
+	// 任务明细
+	Task *RTaskElement `json:"task"`
+	// 最后一次执行的错误信息
+	Error string `json:"error"`
+	// 转入死信队列的时间，毫秒级时间戳
+	FailedAtUnixMilli int64 `json:"failedAtUnixMilli"`
+
+	// 死信在存储后端中的原始内容，用于删除
+	body string
+}
+
+// FailedAt 转入死信队列的时间
+func (d *DeadLetter) FailedAt() time.Time {
+	return time.UnixMilli(d.FailedAtUnixMilli)
+}
+
+// ListDeadLetters 按照失败时间先后顺序分页获取死信
+func (r *RTimeWheel) ListDeadLetters(ctx context.Context, offset, limit int) ([]*DeadLetter, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	replies, err := r.backend.RangeDeadLetters(ctx, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	deadLetters := make([]*DeadLetter, 0, len(replies))
+	for _, body := range replies {
+		var deadLetter DeadLetter
+		if err := json.Unmarshal([]byte(body), &deadLetter); err != nil {
+			log.Error("unmarshal dead letter err", err.Error(), slog.Any("raw dead letter", body))
+			continue
+		}
+		deadLetter.body = body
+		deadLetters = append(deadLetters, &deadLetter)
+	}
+	return deadLetters, nil
+}
+
+// RequeueDeadLetter 将死信重新挂载到时间轮，执行次数从 1 开始重新计算
+// 由更高版本写入的任务返回 ErrUnsupportedVersion，需要在升级后的实例上重新挂载
+func (r *RTimeWheel) RequeueDeadLetter(ctx context.Context, deadLetter *DeadLetter, executeAt time.Time) error {
+	if deadLetter.Task.Version > envelopeVersion {
+		return fmt.Errorf("%w: version %d, supported up to %d", ErrUnsupportedVersion, deadLetter.Task.Version, envelopeVersion)
+	}
+
+	task := *deadLetter.Task
+	task.Attempt = 1
+	// 先写入任务，再删除死信. 中途失败时死信仍然保留，不会丢失
+	if _, err := r.addTask(ctx, &task, executeAt); err != nil {
+		return err
+	}
+
+	return r.backend.RemoveDeadLetters(ctx, deadLetter.body)
+}
+
+// PurgeDeadLetters 清理在 before 之前转入死信队列的死信，返回清理的数量
+func (r *RTimeWheel) PurgeDeadLetters(ctx context.Context, before time.Time) (int, error) {
+	return r.backend.PurgeDeadLetters(ctx, before)
+}
+
+// deadLetter 将任务转入死信队列，并确认原任务处理完成
+// 死信中保存任务在存储后端中的原始内容，更高版本写入的字段不会丢失
+func (r *RTimeWheel) deadLetter(ctx context.Context, task *RTaskElement, cause error) error {
+	failedAt := time.Now()
+	raw := json.RawMessage(task.body)
+	if len(raw) == 0 {
+		raw, _ = json.Marshal(task)
+	}
+	body, _ := json.Marshal(&struct {
+		Task              json.RawMessage `json:"task"`
+		Error             string          `json:"error"`
+		FailedAtUnixMilli int64           `json:"failedAtUnixMilli"`
+	}{
+		Task:              raw,
+		Error:             cause.Error(),
+		FailedAtUnixMilli: failedAt.UnixMilli(),
+	})
+
+	// 先写入死信，再 ack 原任务. 中途失败时原任务会被回收重新执行，不会丢失
+	if err := r.backend.AddDeadLetter(ctx, failedAt, string(body)); err != nil {
+		return err
+	}
+	return r.ackTasks(ctx, task.ExecuteAt(), task.backendTask())
+}
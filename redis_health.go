@@ -0,0 +1,77 @@
+package timewheel
+
+import (
+	"sync"
+	"time"
+)
+
+// RHealth redis 版时间轮在当前实例上的健康状况，可用于就绪探针
+// 开启 leader 选举时只有 leader 扫描任务，非 leader 实例的扫描状态不会更新
+type RHealth struct {
+	// 当前实例是否负责扫描任务
+	Scanning bool
+	// 最近一次扫描成功完成的时间，尚未成功扫描过时为零值
+	LastScan time.Time
+	// 最近一次扫描成功后推进到的水位
+	Watermark time.Time
+	// 连续扫描失败的次数，扫描成功后清零
+	ConsecutiveFailures int
+	// 最近一次扫描失败的错误，扫描成功后清空
+	LastError error
+	// 积压时长，即当前时刻与水位之间尚未扫描的时间范围. 尚未成功扫描过时为 0
+	Backlog time.Duration
+}
+
+// Healthy 是否健康：最近一次扫描成功，并且积压时长不超过 maxBacklog
+// maxBacklog 小于等于 0 时不检查积压时长. 不负责扫描的实例始终认为是健康的
+func (h RHealth) Healthy(maxBacklog time.Duration) bool {
+	if !h.Scanning {
+		return true
+	}
+	if h.ConsecutiveFailures > 0 || h.LastScan.IsZero() {
+		return false
+	}
+	return maxBacklog <= 0 || h.Backlog <= maxBacklog
+}
+
+// healthTracker 记录扫描结果
+type healthTracker struct {
+	mu        sync.Mutex
+	lastScan  time.Time
+	watermark time.Time
+	failures  int
+	lastErr   error
+}
+
+// record 记录一次扫描的结果
+func (h *healthTracker) record(watermark time.Time, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err != nil {
+		h.failures++
+		h.lastErr = err
+		return
+	}
+	h.lastScan = time.Now()
+	h.watermark = watermark
+	h.failures = 0
+	h.lastErr = nil
+}
+
+// Health 获取时间轮在当前实例上的健康状况
+func (r *RTimeWheel) Health() RHealth {
+	r.health.mu.Lock()
+	defer r.health.mu.Unlock()
+
+	health := RHealth{
+		Scanning:            r.IsLeader(),
+		LastScan:            r.health.lastScan,
+		Watermark:           r.health.watermark,
+		ConsecutiveFailures: r.health.failures,
+		LastError:           r.health.lastErr,
+	}
+	if !health.Watermark.IsZero() {
+		health.Backlog = max(time.Since(health.Watermark), 0)
+	}
+	return health
+}
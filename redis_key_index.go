@@ -0,0 +1,80 @@
+package timewheel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/dej4vu/timewheel/pkg/backend"
+)
+
+// ErrTaskNotFound key 对应的任务不存在，或者已经执行完成
+var ErrTaskNotFound = errors.New("timewheel: task not found")
+
+// GetTask 通过 key 索引获取尚未执行完成的任务，任务不存在时返回 ErrTaskNotFound
+func (r *RTimeWheel) GetTask(ctx context.Context, key string) (*RTaskElement, error) {
+	found, err := r.backend.Lookup(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, ErrTaskNotFound
+	}
+	return parseTask(found)
+}
+
+// Reschedule 通过 key 索引将任务调整到新的执行时间，任务内容保持不变，执行次数重新计算
+// 仅当 key 索引仍然指向读取到的任务时原子替换原任务，任务不存在，或者在此期间执行完成、被删除或者被替换时返回 ErrTaskNotFound
+func (r *RTimeWheel) Reschedule(ctx context.Context, key string, executeAt time.Time) error {
+	found, err := r.backend.Lookup(ctx, key)
+	if err != nil {
+		return err
+	}
+	if found == nil {
+		return ErrTaskNotFound
+	}
+	task, err := parseTask(found)
+	if err != nil {
+		return err
+	}
+
+	task.Attempt = 1
+	if now := time.Now(); executeAt.Before(now) {
+		executeAt = now
+	}
+	replaced, err := r.backend.Replace(ctx, *found, encodeTask(task, executeAt))
+	if err != nil {
+		return err
+	}
+	if !replaced {
+		return ErrTaskNotFound
+	}
+
+	r.hooks.replace(HookEvent{Key: key, ExecuteAt: executeAt})
+	return nil
+}
+
+// removeKey 通过 key 索引删除任务
+func (r *RTimeWheel) removeKey(ctx context.Context, key string) error {
+	removed, err := r.backend.RemoveKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	if removed == nil {
+		return ErrTaskNotFound
+	}
+
+	r.hooks.remove(HookEvent{Key: key, ExecuteAt: removed.ExecuteAt})
+	return nil
+}
+
+// parseTask 解析 key 索引指向的任务
+func parseTask(found *backend.Task) (*RTaskElement, error) {
+	var task RTaskElement
+	if err := json.Unmarshal([]byte(found.Body), &task); err != nil {
+		return nil, err
+	}
+	task.body = found.Body
+	return &task, nil
+}
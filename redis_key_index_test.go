@@ -0,0 +1,198 @@
+package timewheel
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dej4vu/timewheel/internal/redistest"
+	"github.com/dej4vu/timewheel/pkg/backend"
+	"github.com/dej4vu/timewheel/pkg/backend/memory"
+	"github.com/dej4vu/timewheel/pkg/redis"
+	"github.com/dej4vu/timewheel/pkg/redis/fake"
+	"github.com/dej4vu/timewheel/pkg/redis/goredis"
+)
+
+// runKeyIndexBackends 在各个维护 key 索引的存储后端上并行执行测试
+func runKeyIndexBackends(t *testing.T, test func(t *testing.T, b backend.Backend)) {
+	for name, factory := range map[string]func(t *testing.T) backend.Backend{
+		"memory": func(t *testing.T) backend.Backend { return memory.New() },
+		"fake":   func(t *testing.T) backend.Backend { return mustNewBackend(t, fake.New(), redis.WithHashTag("test")) },
+		// cluster 模式下设置 hash tag 后开启 key 索引
+		"fake_cluster": func(t *testing.T) backend.Backend {
+			return mustNewBackend(t, fake.NewCluster(), redis.WithHashTag("test"))
+		},
+		"goredis": func(t *testing.T) backend.Backend {
+			return newTestRedisBackend(t, goredis.NewClient(network, redistest.StartServer(t), ""))
+		},
+	} {
+		name, factory := name, factory
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			test(t, factory(t))
+		})
+	}
+}
+
+func Test_RTimeWheel_KeyIndex(t *testing.T) {
+	runKeyIndexBackends(t, testKeyIndex)
+}
+
+func Test_RTimeWheel_Replace(t *testing.T) {
+	runKeyIndexBackends(t, testReplace)
+}
+
+func testKeyIndex(t *testing.T, b backend.Backend) {
+	ctx := context.Background()
+	var (
+		mu       sync.Mutex
+		executed = make(map[string][]time.Time)
+	)
+	rTimeWheel := NewRTimeWheelWithBackend(b, func(ctx context.Context, task *RTaskElement) error {
+		mu.Lock()
+		executed[task.Key] = append(executed[task.Key], time.Now())
+		mu.Unlock()
+		return nil
+	}, WithPollInterval(100*time.Millisecond))
+	defer rTimeWheel.Stop()
+
+	executeAt := time.Now().Add(500 * time.Millisecond)
+	for _, key := range []string{"a", "b", "c"} {
+		if err := rTimeWheel.AddTask(ctx, key, NewRTaskElement(key, "test"), executeAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 只通过 key 删除任务
+	if err := rTimeWheel.RemoveTask(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rTimeWheel.RemoveTask(ctx, "a"); !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("remove again err = %v, want ErrTaskNotFound", err)
+	}
+
+	task, err := rTimeWheel.GetTask(ctx, "b")
+	if err != nil || task.Msg != "b" || task.ExecuteAt().UnixMilli() != executeAt.UnixMilli() {
+		t.Fatalf("get task = %+v, %v", task, err)
+	}
+
+	rescheduleAt := executeAt.Add(time.Second)
+	if err := rTimeWheel.Reschedule(ctx, "c", rescheduleAt); err != nil {
+		t.Fatal(err)
+	}
+	if task, err := rTimeWheel.GetTask(ctx, "c"); err != nil || task.Msg != "c" || task.ExecuteAt().UnixMilli() != rescheduleAt.UnixMilli() {
+		t.Fatalf("rescheduled task = %+v, %v", task, err)
+	}
+	if err := rTimeWheel.Reschedule(ctx, "missing", rescheduleAt); !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("reschedule missing err = %v, want ErrTaskNotFound", err)
+	}
+
+	<-time.After(2500 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(executed["a"]) != 0 {
+		t.Errorf("removed task executed %d times", len(executed["a"]))
+	}
+	if len(executed["b"]) != 1 {
+		t.Errorf("task b executed %d times, want 1", len(executed["b"]))
+	}
+	if len(executed["c"]) != 1 || executed["c"][0].Before(rescheduleAt) {
+		t.Errorf("rescheduled task executed at %v, want once after %v", executed["c"], rescheduleAt)
+	}
+	// 执行完成后 key 索引随 ack 清除
+	if _, err := rTimeWheel.GetTask(ctx, "b"); !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("get executed task err = %v, want ErrTaskNotFound", err)
+	}
+	// 执行完成的任务不会被重新写入
+	if err := rTimeWheel.Reschedule(ctx, "b", time.Now()); !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("reschedule executed task err = %v, want ErrTaskNotFound", err)
+	}
+}
+
+// testReplace 重复添加同一 key 的任务，只执行最后一次写入的任务
+func testReplace(t *testing.T, b backend.Backend) {
+	ctx := context.Background()
+	var (
+		mu       sync.Mutex
+		executed = make(map[string][]string)
+	)
+	rTimeWheel := NewRTimeWheelWithBackend(b, func(ctx context.Context, task *RTaskElement) error {
+		mu.Lock()
+		executed[task.Key] = append(executed[task.Key], task.Msg)
+		mu.Unlock()
+		return nil
+	}, WithPollInterval(100*time.Millisecond))
+	defer rTimeWheel.Stop()
+
+	now := time.Now()
+	// 替换执行时间以及任务内容，执行时间提前或者推后
+	for _, step := range []struct {
+		key, msg  string
+		executeAt time.Time
+	}{
+		{"later", "1", now.Add(500 * time.Millisecond)},
+		{"later", "2", now.Add(1500 * time.Millisecond)},
+		{"earlier", "1", now.Add(1500 * time.Millisecond)},
+		{"earlier", "2", now.Add(500 * time.Millisecond)},
+		{"same", "1", now.Add(500 * time.Millisecond)},
+		{"same", "2", now.Add(500 * time.Millisecond)},
+	} {
+		if err := rTimeWheel.AddTask(ctx, step.key, NewRTaskElement(step.msg, "test"), step.executeAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	<-time.After(3 * time.Second)
+	mu.Lock()
+	defer mu.Unlock()
+	for key, want := range map[string]string{"later": "2", "earlier": "2", "same": "2"} {
+		if got := executed[key]; len(got) != 1 || got[0] != want {
+			t.Errorf("task %s executed %v, want [%s]", key, got, want)
+		}
+	}
+}
+
+func Test_RTimeWheel_WithoutKeyIndex(t *testing.T) {
+	for name, store := range map[string]redis.Store{
+		"standalone": fake.New(),
+		// cluster 模式下没有设置 hash tag 时需要显式关闭 key 索引
+		"cluster": fake.NewCluster(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			rTimeWheel := NewRTimeWheelWithBackend(mustNewBackend(t, store, redis.WithoutKeyIndex()), func(ctx context.Context, task *RTaskElement) error {
+				return nil
+			})
+			defer rTimeWheel.Stop()
+
+			executeAt := time.Now().Add(time.Hour)
+			if err := rTimeWheel.AddTask(ctx, "a", NewRTaskElement("a", "test"), executeAt); err != nil {
+				t.Fatal(err)
+			}
+			if err := rTimeWheel.RemoveTask(ctx, "a"); !errors.Is(err, backend.ErrKeyIndexDisabled) {
+				t.Errorf("remove err = %v, want ErrKeyIndexDisabled", err)
+			}
+			if err := rTimeWheel.RemoveTask(ctx, "a", executeAt); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// Test_RTimeWheel_ShardedKeyIndex 分片模式下既没有设置 hash tag 也没有关闭 key 索引时构造失败，不会静默关闭 key 索引
+func Test_RTimeWheel_ShardedKeyIndex(t *testing.T) {
+	if _, err := redis.NewBackend(fake.NewCluster()); !errors.Is(err, redis.ErrHashTagRequired) {
+		t.Errorf("new backend err = %v, want ErrHashTagRequired", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("NewRTimeWheel with a sharded store should panic")
+		}
+	}()
+	NewRTimeWheel(fake.NewCluster(), func(ctx context.Context, task *RTaskElement) error {
+		return nil
+	}).Stop()
+}
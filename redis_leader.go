@@ -0,0 +1,96 @@
+package timewheel
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// fencingTokenKey 在任务执行的 ctx 中存放 fencing token 的 key
+type fencingTokenKey struct{}
+
+// FencingTokenFromContext 获取 leader 选举模式下，执行当前任务的 leader 持有的 fencing token
+// fencing token 随每次 leader 变更单调递增，下游存储可以据此拒绝过期 leader 的写入
+func FencingTokenFromContext(ctx context.Context) (int64, bool) {
+	token, ok := ctx.Value(fencingTokenKey{}).(int64)
+	return token, ok
+}
+
+// IsLeader 当前实例是否为 leader. 未开启 leader 选举时恒为 true
+func (r *RTimeWheel) IsLeader() bool {
+	return r.leaderTTL <= 0 || r.fencingToken.Load() > 0
+}
+
+// FencingToken 当前实例持有的 fencing token，非 leader 时返回 0
+func (r *RTimeWheel) FencingToken() int64 {
+	return r.fencingToken.Load()
+}
+
+// elect 周期性地竞选或者续期 leader 租约，时间轮停止时主动释放租约
+func (r *RTimeWheel) elect() {
+	ticker := time.NewTicker(r.leaderTTL / 3)
+	defer ticker.Stop()
+
+	r.campaign()
+	for {
+		select {
+		case <-r.stopc:
+			r.resign()
+			return
+		case <-ticker.C:
+			r.campaign()
+		}
+	}
+}
+
+// campaign 竞选或者续期 leader 租约. 与存储后端交互失败时无法确认租约状态，主动放弃 leader 身份
+func (r *RTimeWheel) campaign() {
+	ctx, cancel := context.WithTimeout(context.Background(), r.leaderTTL/3)
+	defer cancel()
+
+	token, err := r.backend.AcquireLeader(ctx, r.consumerID, r.leaderTTL)
+	if err != nil {
+		log.Error("campaign leader", slog.Any("error", err))
+		r.setFencingToken(0)
+		return
+	}
+	r.setFencingToken(token)
+}
+
+// resign 释放当前实例持有的 leader 租约，便于其他实例尽快接管
+func (r *RTimeWheel) resign() {
+	if r.fencingToken.Load() == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.leaderTTL/3)
+	defer cancel()
+	if err := r.backend.ReleaseLeader(ctx, r.consumerID); err != nil {
+		log.Error("resign leader", slog.Any("error", err))
+	}
+	r.setFencingToken(0)
+}
+
+// setFencingToken 更新 fencing token，leader 身份或者 fencing token 发生变化时触发回调
+func (r *RTimeWheel) setFencingToken(token int64) {
+	if old := r.fencingToken.Swap(token); old == token {
+		return
+	}
+
+	log.Info("leadership changed", slog.Any("consumer", r.consumerID), slog.Any("leader", token > 0), slog.Any("token", token))
+	if r.onLeadershipChange != nil {
+		r.onLeadershipChange(token > 0, token)
+	}
+}
+
+// defaultConsumerID 以主机名、进程号以及随机数生成实例的唯一标识
+func defaultConsumerID() string {
+	hostname, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), hex.EncodeToString(suffix))
+}
@@ -3,18 +3,58 @@ package timewheel
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/dej4vu/timewheel/pkg/backend"
 	"github.com/dej4vu/timewheel/pkg/redis"
 	"github.com/dej4vu/timewheel/pkg/util"
-	"github.com/demdxx/gocast"
 )
 
 var log = slog.Default().With("TimeWheel", "core")
 
+// errRStopped redis 版时间轮已停止
+var errRStopped = errors.New("timewheel: redis time wheel stopped")
+
+// ErrMaxDeliveries 任务被取出的次数超过上限，不再执行并转入死信队列
+var ErrMaxDeliveries = errors.New("timewheel: max deliveries exceeded")
+
+// ErrUnsupportedVersion 任务由更高版本的时间轮写入，当前实例无法处理，转入死信队列
+var ErrUnsupportedVersion = errors.New("timewheel: unsupported task version")
+
+const (
+	// 默认的任务租约时长
+	defaultVisibilityTimeout = 30 * time.Second
+	// 默认回收租约过期任务的时间窗口
+	defaultReclaimWindow = time.Hour
+	// 默认同一任务被取出次数的上限
+	defaultMaxDeliveries = 10
+	// 任务执行结束后 ack、重试以及转入死信队列的超时时间
+	ackTimeout = 5 * time.Second
+	// 扫描以及回收过程中单次调用存储后端的超时时间
+	backendTimeout = 5 * time.Second
+	// 单个分钟级时间片每次回收任务的数量上限
+	reclaimBatchSize = 100
+	// 默认单次取出任务的数量上限
+	defaultBatchSize = 100
+	// 默认的最大补偿扫描时长，与删除集合的过期时间保持一致
+	defaultMaxCatchUp = time.Hour
+	// 每次扫描从水位向前回溯的时长，覆盖扫描与添加任务并发时的边界情况
+	watermarkLookback = 2 * time.Second
+	// 默认的扫描时间间隔
+	defaultPollInterval = time.Second
+	// 默认并发执行任务的 worker 数量
+	defaultWorkers = 100
+	// 当前写入的任务格式版本. 历史版本写入的任务为 0，任务明细只包含 Msg
+	// 版本 1 起可以通过 Codec、Payload 保存类型化任务的内容
+	envelopeVersion = 1
+)
+
 // RTaskElement 任务明细
 type RTaskElement struct {
 	// 任务 key
@@ -23,8 +63,43 @@ type RTaskElement struct {
 	Msg string `json:"msg"`
 	// 任务类型
 	Type string `json:"type"`
-	// 执行时间
+	// 执行时间，秒级时间戳
 	ExecuteAtUnix int64 `json:"executeAtUnix"`
+	// 执行时间，毫秒级时间戳. 历史版本写入的任务中不存在该字段
+	ExecuteAtUnixMilli int64 `json:"executeAtUnixMilli,omitempty"`
+	// 当前的执行次数，从 1 开始
+	Attempt int `json:"attempt,omitempty"`
+	// 任务格式的版本，历史版本写入的任务中不存在该字段
+	Version int `json:"version,omitempty"`
+	// 类型化任务内容的编解码器名称
+	Codec string `json:"codec,omitempty"`
+	// 类型化任务的内容，由 Codec 编码. 与 Msg 二选一
+	Payload []byte `json:"payload,omitempty"`
+	// 任务的元数据，例如链路追踪上下文、租户 ID、生产方服务以及关联 ID，随任务原样传递给处理函数
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// 任务在存储后端中的原始内容，用于 ack
+	body string
+	// 任务被取出的次数，包含租约过期后的回收
+	deliveries int
+}
+
+// ExecuteAt 任务的执行时间，兼容仅记录秒级执行时间的历史任务
+func (t *RTaskElement) ExecuteAt() time.Time {
+	if t.ExecuteAtUnixMilli > 0 {
+		return time.UnixMilli(t.ExecuteAtUnixMilli)
+	}
+	return time.Unix(t.ExecuteAtUnix, 0)
+}
+
+// backendTask 任务在存储后端中的记录，用于 ack
+func (t *RTaskElement) backendTask() backend.Task {
+	return backend.Task{Key: t.Key, ExecuteAt: t.ExecuteAt(), Body: t.body}
+}
+
+// attempt 任务当前的执行次数，兼容未记录执行次数的历史任务
+func (t *RTaskElement) attempt() int {
+	return max(t.Attempt, 1)
 }
 
 // NewRTaskElement 创建新任务
@@ -35,8 +110,11 @@ func NewRTaskElement(msg string, _type string) *RTaskElement {
 	}
 }
 
-// RTimeWheel redis实现的分布式时间轮
+// RTimeWheel 分布式时间轮，默认基于 redis 存储任务
 type RTimeWheel struct {
+	// 扫描、回收等后台流程的根 ctx，时间轮停止时取消
+	runCtx    context.Context
+	cancelRun context.CancelFunc
 	// 内置的单例工具，用于保证 stopc 只被关闭一次
 	sync.Once
 	// 任务处理函数
@@ -45,69 +123,176 @@ type RTimeWheel struct {
 	stopc chan struct{}
 	// 触发定时扫描任务的定时器
 	ticker *time.Ticker
-	// redis存储接口
-	store redis.Store
+	// 存储后端
+	backend backend.Backend
+	// 生命周期回调
+	hooks *Hooks
+	// 任务租约时长. 任务被取出后需要在租约内处理完成并 ack，否则会被重新执行
+	visibilityTimeout time.Duration
+	// 回收租约过期任务的时间窗口，只回收执行时间在窗口内的任务
+	reclaimWindow time.Duration
+	// 同一任务被取出次数的上限，超过上限时不再执行，转入死信队列
+	maxDeliveries int
+	// 触发回收租约过期任务的定时器
+	reclaimTicker *time.Ticker
+	// 各任务类型的重试策略，空字符串对应默认策略
+	retryPolicies map[string]*RetryPolicy
+	// 单次取出任务的数量上限
+	batchSize int
+	// 最大补偿扫描时长，水位落后超过该时长的部分不再扫描
+	maxCatchUp time.Duration
+	// 是否正在扫描，保证同一时刻只有一个扫描 goroutine
+	scanning atomic.Bool
+	// 扫描时间间隔
+	pollInterval time.Duration
+	// 是否正在回收租约过期的任务
+	reclaiming atomic.Bool
+	// 执行任务的 worker 令牌，容量即为并发执行任务数量的上限，为空时不限制
+	workers chan struct{}
+	// 累计计数器
+	counters rcounters
+	// 实例的唯一标识
+	consumerID string
+	// leader 租约时长，大于 0 时开启 leader 选举，只有 leader 扫描并执行任务
+	leaderTTL time.Duration
+	// 当前实例持有的 fencing token，非 leader 时为 0
+	fencingToken atomic.Int64
+	// leader 身份变化时的回调
+	onLeadershipChange func(isLeader bool, token int64)
+	// 扫描的健康状况
+	health healthTracker
 }
 
 // NewRTimeWheel 构造 redis 实现的分布式时间轮
-func NewRTimeWheel(store redis.Store, handle func(context.Context, *RTaskElement) error) *RTimeWheel {
+// store 为 cluster、Ring 等分片模式的客户端时，需要通过 NewRTimeWheelWithBackend 以及 redis.WithHashTag 或者 redis.WithoutKeyIndex
+// 构造存储后端，否则 panic
+func NewRTimeWheel(store redis.Store, handle func(context.Context, *RTaskElement) error, opts ...ROption) *RTimeWheel {
+	b, err := redis.NewBackend(store)
+	if err != nil {
+		panic("timewheel: " + err.Error())
+	}
+	return NewRTimeWheelWithBackend(b, handle, opts...)
+}
+
+// NewRTimeWheelWithBackend 基于指定的存储后端构造分布式时间轮
+func NewRTimeWheelWithBackend(b backend.Backend, handle func(context.Context, *RTaskElement) error, opts ...ROption) *RTimeWheel {
 	r := &RTimeWheel{
-		ticker: time.NewTicker(time.Second),
-		stopc:  make(chan struct{}),
-		handle: handle,
-		store:  store,
+		stopc:             make(chan struct{}),
+		handle:            handle,
+		backend:           b,
+		visibilityTimeout: defaultVisibilityTimeout,
+		reclaimWindow:     defaultReclaimWindow,
+		maxDeliveries:     defaultMaxDeliveries,
+		batchSize:         defaultBatchSize,
+		maxCatchUp:        defaultMaxCatchUp,
+		pollInterval:      defaultPollInterval,
+		workers:           make(chan struct{}, defaultWorkers),
+		consumerID:        defaultConsumerID(),
+	}
+
+	for _, opt := range opts {
+		opt(r)
 	}
 
+	r.runCtx, r.cancelRun = context.WithCancel(context.Background())
+	r.ticker = time.NewTicker(r.pollInterval)
+	// 每半个租约时长回收一次租约过期的任务
+	r.reclaimTicker = time.NewTicker(r.visibilityTimeout / 2)
+
+	if r.leaderTTL > 0 {
+		go r.elect()
+	}
 	go r.run()
 	return r
 }
 
+// Stats 获取时间轮在当前实例上的运行指标快照，可用于衡量各实例的吞吐量
+func (r *RTimeWheel) Stats() RStats {
+	return RStats{
+		Workers:     cap(r.workers),
+		Busy:        len(r.workers),
+		Claimed:     r.counters.claimed.Load(),
+		Reclaimed:   r.counters.reclaimed.Load(),
+		Executed:    r.counters.executed.Load(),
+		Failed:      r.counters.failed.Load(),
+		Panicked:    r.counters.panicked.Load(),
+		Exhausted:   r.counters.exhausted.Load(),
+		Unsupported: r.counters.unsupported.Load(),
+	}
+}
+
 // Stop 停止时间轮
 func (r *RTimeWheel) Stop() {
 	r.Do(func() {
 		close(r.stopc)
+		r.cancelRun()
 		r.ticker.Stop()
+		r.reclaimTicker.Stop()
 	})
 }
 
-// AddTask 添加定时任务
+// AddTask 添加定时任务. 执行时间早于当前时间的任务，按照当前时间挂载
+// key 已存在尚未完成的任务时原子替换原任务，未维护 key 索引的存储后端除外
+// ctx 中保存了 W3C traceparent 时写入任务 Headers 的副本，执行任务时传递给处理函数的 ctx. 调用方传入的 Headers 不会被修改
 func (r *RTimeWheel) AddTask(ctx context.Context, key string, task *RTaskElement, executeAt time.Time) error {
 	if err := r.addTaskPrecheck(task); err != nil {
 		return err
 	}
 
+	task.Headers = maps.Clone(task.Headers)
+	InjectTraceparent(ctx, task)
 	task.Key = key
+	task.Attempt = 1
+	if now := time.Now(); executeAt.Before(now) {
+		executeAt = now
+	}
+	replaced, err := r.addTask(ctx, task, executeAt)
+	if err != nil {
+		return err
+	}
+
+	// 与本地时间轮一致，覆盖同一 key 的已有任务时回调 OnReplace
+	event := HookEvent{Key: key, ExecuteAt: executeAt}
+	if replaced {
+		r.hooks.replace(event)
+	} else {
+		r.hooks.add(event)
+	}
+	return nil
+}
+
+// addTask 将任务写入执行时间对应的分钟级时间片，返回是否替换了同一 key 的已有任务
+func (r *RTimeWheel) addTask(ctx context.Context, task *RTaskElement, executeAt time.Time) (bool, error) {
+	return r.backend.Add(ctx, encodeTask(task, executeAt))
+}
+
+// encodeTask 以当前的任务格式版本序列化任务
+func encodeTask(task *RTaskElement, executeAt time.Time) backend.Task {
 	task.ExecuteAtUnix = executeAt.Unix()
+	task.ExecuteAtUnixMilli = executeAt.UnixMilli()
+	task.Version = envelopeVersion
 	taskBody, _ := json.Marshal(task)
-	_, err := r.store.Eval(ctx, redis.AddTaskLuaScript,
-		[]string{
-			// 分钟级 zset 时间片
-			r.getMinuteSlice(executeAt),
-			// 标识任务删除的集合
-			r.getDeleteSetKey(executeAt),
-		},
-		[]interface{}{
-			// 以执行时刻的秒级时间戳作为 zset 中的 score
-			executeAt.Unix(),
-			// 任务明细
-			string(taskBody),
-			// 任务 key，用于存放在删除集合中
-			key,
-		})
-	return err
+	return backend.Task{
+		Key:       task.Key,
+		ExecuteAt: executeAt,
+		Body:      string(taskBody),
+	}
 }
 
 // RemoveTask 从 redis 时间轮中删除一个定时任务
-func (r *RTimeWheel) RemoveTask(ctx context.Context, key string, executeAt time.Time) error {
-	//定时任务距离当前时间的秒数+3600s
-	ttl := int(time.Until(executeAt).Seconds()) + 3600
+// 未指定执行时间时通过 key 索引查找任务，任务不存在时返回 ErrTaskNotFound
+func (r *RTimeWheel) RemoveTask(ctx context.Context, key string, executeAt ...time.Time) error {
+	if len(executeAt) == 0 {
+		return r.removeKey(ctx, key)
+	}
 
 	// 标识任务已被删除
-	_, err := r.store.Eval(ctx, redis.DeleteTaskLuaScript,
-		[]string{r.getDeleteSetKey(executeAt)},
-		[]interface{}{key, ttl},
-	)
-	return err
+	if err := r.backend.Remove(ctx, key, executeAt[0]); err != nil {
+		return err
+	}
+
+	r.hooks.remove(HookEvent{Key: key, ExecuteAt: executeAt[0]})
+	return nil
 }
 
 func (r *RTimeWheel) run() {
@@ -116,12 +301,21 @@ func (r *RTimeWheel) run() {
 		case <-r.stopc:
 			return
 		case <-r.ticker.C:
-			// 每次 tick 获取任务
-			go r.executeTasks()
+			// 每次 tick 获取任务. 开启 leader 选举时，只有 leader 获取任务
+			if r.IsLeader() {
+				go r.executeTasks()
+			}
+		case <-r.reclaimTicker.C:
+			// 回收租约过期的任务
+			if r.IsLeader() {
+				go r.reclaimTasks()
+			}
 		}
 	}
 }
 
+// executeTasks 从已扫描完成的水位开始，逐个分钟级时间片扫描到当前时刻，分批取出任务执行
+// 因 ticker 漂移、GC 停顿、实例重启等原因错过的秒级时间范围，会在后续扫描中补偿
 func (r *RTimeWheel) executeTasks() {
 	defer func() {
 		if err := recover(); err != nil {
@@ -129,16 +323,182 @@ func (r *RTimeWheel) executeTasks() {
 		}
 	}()
 
-	// 并发控制，保证 30 s 之内完成该批次全量任务的执行，及时回收 goroutine，避免发生 goroutine 泄漏
-	tctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
-	defer cancel()
-	tasks, err := r.getExecutableTasks(tctx)
+	// 上一次扫描尚未结束时，跳过本次扫描
+	if !r.scanning.CompareAndSwap(false, true) {
+		return
+	}
+	defer r.scanning.Store(false)
+
+	watermark, err := r.scan()
+	// 时间轮停止导致的扫描中断不计入健康状况
+	if errors.Is(err, errRStopped) || r.runCtx.Err() != nil {
+		return
+	}
+	r.health.record(watermark, err)
+}
+
+// scan 扫描截止到当前时刻的全部到期任务，返回扫描完成后的水位
+// 每次调用存储后端使用单独的超时时间，等待空闲 worker 的时长不计入其中
+func (r *RTimeWheel) scan() (time.Time, error) {
+	to := time.Now()
+	ctx, cancel := r.backendContext()
+	from, err := r.getWatermark(ctx)
+	cancel()
 	if err != nil {
-		log.Error("get executable tasks", slog.Any("error", err))
+		log.Error("get watermark", slog.Any("error", err))
+		return time.Time{}, err
+	}
+	if earliest := to.Add(-r.maxCatchUp); from.Before(earliest) {
+		from = earliest
+	}
+	from = from.Add(-watermarkLookback)
+
+	for minute := from.Truncate(time.Minute); !minute.After(to); minute = minute.Add(time.Minute) {
+		for {
+			claimed, limit, err := r.executeBatch(minute, from, to)
+			if err != nil {
+				log.Error("get executable tasks", slog.Any("minute", util.GetTimeMinuteStr(minute)), slog.Any("error", err))
+				return time.Time{}, err
+			}
+			if claimed < limit {
+				break
+			}
+		}
+
+		// 时间片扫描完成后推进水位
+		watermark := minute.Add(time.Minute - time.Millisecond)
+		if watermark.After(to) {
+			watermark = to
+		}
+		ctx, cancel := r.backendContext()
+		err := r.advanceWatermark(ctx, watermark)
+		cancel()
+		if err != nil {
+			log.Error("advance watermark", slog.Any("error", err))
+			return time.Time{}, err
+		}
+	}
+	return to, nil
+}
+
+// executeBatch 等待空闲的 worker，按照空闲 worker 的数量从分钟级时间片中取出一批执行时间在 (from, to] 范围内的任务并异步执行
+// 返回取出的任务数量以及本次取出的数量上限. 所有 worker 都繁忙时不再取出任务，剩余任务交由其他实例处理，从而在多个实例之间均衡负载
+func (r *RTimeWheel) executeBatch(minute, from, to time.Time) (int, int, error) {
+	limit := r.acquireWorkers(r.batchSize)
+	if limit == 0 {
+		return 0, 0, errRStopped
+	}
+
+	ctx, cancel := r.backendContext()
+	tasks, claimed, err := r.getExecutableTasks(ctx, minute, from, to, limit)
+	cancel()
+	if err != nil {
+		r.releaseWorkers(limit)
+		return 0, 0, err
+	}
+
+	r.counters.claimed.Add(uint64(len(tasks)))
+	r.releaseWorkers(limit - len(tasks))
+	// 并发控制，保证在租约时长内完成该批次全量任务的执行，及时回收 goroutine，避免发生 goroutine 泄漏
+	tctx, tcancel := context.WithTimeout(r.taskContext(), r.visibilityTimeout)
+	r.dispatch(tctx, tcancel, tasks)
+	return claimed, limit, nil
+}
+
+// reclaimTasks 回收时间窗口内租约已过期的任务，并重新执行
+func (r *RTimeWheel) reclaimTasks() {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("recover from err", err)
+		}
+	}()
+
+	// 上一次回收尚未结束时，跳过本次回收
+	if !r.reclaiming.CompareAndSwap(false, true) {
 		return
 	}
+	defer r.reclaiming.Store(false)
 
-	// 并发执行任务
+	now := time.Now()
+	for minute := now.Add(-r.reclaimWindow).Truncate(time.Minute); !minute.After(now); minute = minute.Add(time.Minute) {
+		limit := r.acquireWorkers(reclaimBatchSize)
+		if limit == 0 {
+			return
+		}
+
+		ctx, cancel := r.backendContext()
+		tasks, err := r.reclaimMinuteTasks(ctx, minute, now, limit)
+		cancel()
+		if err != nil {
+			r.releaseWorkers(limit)
+			log.Error("reclaim tasks", slog.Any("minute", util.GetTimeMinuteStr(minute)), slog.Any("error", err))
+			continue
+		}
+
+		r.counters.reclaimed.Add(uint64(len(tasks)))
+		r.releaseWorkers(limit - len(tasks))
+		tctx, tcancel := context.WithTimeout(r.taskContext(), r.visibilityTimeout)
+		r.dispatch(tctx, tcancel, tasks)
+	}
+}
+
+// taskContext 任务执行的根 ctx. 开启 leader 选举时携带 fencing token
+func (r *RTimeWheel) taskContext() context.Context {
+	ctx := context.Background()
+	if r.leaderTTL > 0 {
+		ctx = context.WithValue(ctx, fencingTokenKey{}, r.FencingToken())
+	}
+	return ctx
+}
+
+// backendContext 扫描以及回收过程中调用存储后端使用的 ctx，时间轮停止时随之取消
+func (r *RTimeWheel) backendContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(r.runCtx, backendTimeout)
+}
+
+// ackContext 任务执行结束后 ack、重试以及转入死信队列使用的 ctx，不受租约到期的影响
+func (r *RTimeWheel) ackContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(r.taskContext(), ackTimeout)
+}
+
+// acquireWorkers 阻塞等待至少一个空闲的 worker，并尽可能多地占用空闲 worker，最多占用 max 个
+// 未限制 worker 数量时直接返回 max，时间轮停止时返回 0
+func (r *RTimeWheel) acquireWorkers(max int) int {
+	if r.workers == nil {
+		return max
+	}
+
+	select {
+	case r.workers <- struct{}{}:
+	case <-r.stopc:
+		return 0
+	}
+	acquired := 1
+	for acquired < max {
+		select {
+		case r.workers <- struct{}{}:
+			acquired++
+		default:
+			return acquired
+		}
+	}
+	return acquired
+}
+
+// releaseWorkers 释放占用的 worker
+func (r *RTimeWheel) releaseWorkers(n int) {
+	if r.workers == nil {
+		return
+	}
+	for i := 0; i < n; i++ {
+		<-r.workers
+	}
+}
+
+// dispatch 异步并发执行任务，每笔任务占用一个 worker，全部执行结束后调用 cancel. 执行成功的任务进行 ack
+// 执行失败的任务按照重试策略重新挂载或者转入死信队列，未设置重试策略时，在租约过期后会被回收重新执行，直到取出次数超过上限
+// 执行结束时 ctx 可能已经随租约到期，ack 等后续操作使用单独的 ctx
+func (r *RTimeWheel) dispatch(ctx context.Context, cancel context.CancelFunc, tasks []*RTaskElement) {
 	var wg sync.WaitGroup
 	for _, task := range tasks {
 		wg.Add(1)
@@ -146,85 +506,223 @@ func (r *RTimeWheel) executeTasks() {
 		task := task
 		go func() {
 			defer func() {
-				if err := recover(); err != nil {
-					log.Error("recover from err", err)
-				}
+				r.releaseWorkers(1)
 				wg.Done()
 			}()
-			if err := r.executeTask(tctx, task); err != nil {
+			err := r.executeTask(ctx, task)
+			actx, acancel := r.ackContext()
+			defer acancel()
+			if err != nil {
+				r.counters.failed.Add(1)
 				log.Error("executeTask err", err.Error(), slog.Any("task key", task.Key))
+				r.retry(actx, task, err)
+				return
+			}
+			r.counters.executed.Add(1)
+			if err := r.ackTasks(actx, task.ExecuteAt(), task.backendTask()); err != nil {
+				log.Error("ack task err", err.Error(), slog.Any("task key", task.Key))
 			}
 		}()
 	}
-	wg.Wait()
+
+	go func() {
+		wg.Wait()
+		cancel()
+	}()
+}
+
+// retry 根据任务类型对应的重试策略，将失败的任务重新挂载到退避时间对应的时间片，或者在重试耗尽后转入死信队列
+// 不可重试的错误不论是否设置重试策略，均直接转入死信队列
+func (r *RTimeWheel) retry(ctx context.Context, task *RTaskElement, err error) {
+	policy := r.retryPolicy(task.Type)
+	if policy == nil && !isPermanent(err) {
+		return
+	}
+
+	attempt := task.attempt()
+	if isPermanent(err) || !policy.shouldRetry(attempt, err) {
+		if dlErr := r.deadLetter(ctx, task, err); dlErr != nil {
+			log.Error("dead letter err", dlErr.Error(), slog.Any("task key", task.Key))
+			return
+		}
+		policy.finalFailure(task.Key, attempt, err)
+		return
+	}
+
+	executeAt := time.Now().Add(policy.Backoff(attempt))
+	retryTask := *task
+	retryTask.Attempt = attempt + 1
+	// 先写入重试任务，再 ack 原任务. 中途失败时原任务会被回收重新执行，不会丢失
+	if _, err := r.addTask(ctx, &retryTask, executeAt); err != nil {
+		log.Error("retry task err", err.Error(), slog.Any("task key", task.Key))
+		return
+	}
+	if err := r.ackTasks(ctx, task.ExecuteAt(), task.backendTask()); err != nil {
+		log.Error("ack task err", err.Error(), slog.Any("task key", task.Key))
+	}
 }
 
-func (r *RTimeWheel) executeTask(ctx context.Context, task *RTaskElement) error {
-	return r.handle(ctx, task)
+// retryPolicy 获取任务类型对应的重试策略，未单独设置时使用默认策略
+func (r *RTimeWheel) retryPolicy(taskType string) *RetryPolicy {
+	if policy, ok := r.retryPolicies[taskType]; ok {
+		return policy
+	}
+	return r.retryPolicies[""]
+}
+
+func (r *RTimeWheel) executeTask(ctx context.Context, task *RTaskElement) (err error) {
+	event := HookEvent{
+		Key:       task.Key,
+		ExecuteAt: task.ExecuteAt(),
+		FiredAt:   time.Now(),
+	}
+	defer func() {
+		if rec := recover(); rec != nil {
+			r.counters.panicked.Add(1)
+			err = fmt.Errorf("panic: %v", rec)
+			event.Err = err
+			r.hooks.panic(event)
+		}
+	}()
+
+	err = r.handle(ExtractTraceparent(ctx, task), task)
+	event.Err = err
+	r.hooks.fire(event)
+	return err
 }
 
 func (r *RTimeWheel) addTaskPrecheck(task *RTaskElement) error {
-	if task.Msg == "" || task.Type == "" {
+	if (task.Msg == "" && len(task.Payload) == 0) || task.Type == "" {
 		return fmt.Errorf("msg:%s, type:%s should not by empty", task.Msg, task.Type)
 	}
 	return nil
 }
 
-func (r *RTimeWheel) getExecutableTasks(ctx context.Context) ([]*RTaskElement, error) {
-	now := time.Now()
-	// 根据当前时间，推算出其从属的分钟级时间片
-	minuteSlice := r.getMinuteSlice(now)
-	// 推算出其对应的分钟级已删除任务集合
-	deleteSetKey := r.getDeleteSetKey(now)
-	// 以秒级时间戳作为 score 进行 zset 检索
-	nowSecond := util.GetTimeSecond(now)
-	score1 := nowSecond.Unix()
-	score2 := nowSecond.Add(time.Second).Unix()
-	// 执行 lua 脚本，本质上是通过 zrange 指令结合秒级时间戳对应的 score 进行定时任务检索
-	rawReply, err := r.store.Eval(ctx, redis.RangeTasksLuaScript,
-		[]string{minuteSlice, deleteSetKey},
-		[]interface{}{score1, score2},
-	)
+// getExecutableTasks 取出分钟级时间片中执行时间在 (from, to] 范围内的任务，同时返回取出的任务总数（包含已删除的任务）
+// 取出的任务转移到处理中，在租约到期前处理完成并 ack
+func (r *RTimeWheel) getExecutableTasks(ctx context.Context, minute, from, to time.Time, limit int) ([]*RTaskElement, int, error) {
+	claimed, err := r.backend.Claim(ctx, minute, from, to, limit, r.leaseDeadline(time.Now()))
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	// 结果中，首个元素对应为已删除任务的 key 集合，后续元素对应为各笔定时任务
-	replies := gocast.ToInterfaceSlice(rawReply)
-	if len(replies) == 0 {
-		return nil, fmt.Errorf("invalid replies: %v", replies)
+	tasks, err := r.parseTasks(minute, claimed)
+	return tasks, len(claimed.Bodies), err
+}
+
+// getWatermark 获取已扫描完成的水位，尚未记录时返回零值
+func (r *RTimeWheel) getWatermark(ctx context.Context) (time.Time, error) {
+	return r.backend.Watermark(ctx)
+}
+
+// advanceWatermark 推进已扫描完成的水位
+func (r *RTimeWheel) advanceWatermark(ctx context.Context, watermark time.Time) error {
+	return r.backend.AdvanceWatermark(ctx, watermark)
+}
+
+// reclaimMinuteTasks 回收分钟级时间片中租约已过期的任务
+func (r *RTimeWheel) reclaimMinuteTasks(ctx context.Context, minute, now time.Time, limit int) ([]*RTaskElement, error) {
+	claimed, err := r.backend.Reclaim(ctx, minute, now, limit, r.leaseDeadline(now))
+	if err != nil {
+		return nil, err
 	}
 
-	deleteds := gocast.ToStringSlice(replies[0])
-	deletedSet := make(map[string]struct{}, len(deleteds))
-	for _, deleted := range deleteds {
+	return r.parseTasks(minute, claimed)
+}
+
+// parseTasks 解析取出的任务. 已删除的任务直接 ack，不再执行；取出次数超过上限的任务转入死信队列，不再执行
+// ack 以及转入死信队列时各自使用单独的 ctx
+func (r *RTimeWheel) parseTasks(minute time.Time, claimed *backend.Claimed) ([]*RTaskElement, error) {
+	deletedSet := make(map[string]struct{}, len(claimed.Deleted))
+	for _, deleted := range claimed.Deleted {
 		deletedSet[deleted] = struct{}{}
 	}
 
 	// 遍历各笔定时任务，倘若其存在于删除集合中，则跳过，否则追加到 list 中返回，用于后续执行
-	tasks := make([]*RTaskElement, 0, len(replies)-1)
-	for i := 1; i < len(replies); i++ {
+	tasks := make([]*RTaskElement, 0, len(claimed.Bodies))
+	var (
+		skipped     []backend.Task
+		exhausted   []*RTaskElement
+		unsupported []*RTaskElement
+	)
+	for i, body := range claimed.Bodies {
 		var task RTaskElement
-		if err := json.Unmarshal([]byte(gocast.ToString(replies[i])), &task); err != nil {
-			// log
-			log.Error("unmarshal task err", err.Error(), slog.Any("raw task", replies[i]))
+		if err := json.Unmarshal([]byte(body), &task); err != nil {
+			// 无法解析的任务无法执行，直接 ack
+			log.Error("unmarshal task err", err.Error(), slog.Any("raw task", body))
+			skipped = append(skipped, backend.Task{Body: body})
+			continue
 		}
 
+		task.body = body
+		if i < len(claimed.Deliveries) {
+			task.deliveries = claimed.Deliveries[i]
+		}
 		if _, ok := deletedSet[task.Key]; ok {
+			skipped = append(skipped, task.backendTask())
+			continue
+		}
+		// 更高版本写入的任务无法正确处理，保留原始内容转入死信队列，升级后通过 RequeueDeadLetter 重新挂载
+		if task.Version > envelopeVersion {
+			unsupported = append(unsupported, &task)
+			continue
+		}
+		if r.maxDeliveries > 0 && task.deliveries > r.maxDeliveries {
+			exhausted = append(exhausted, &task)
 			continue
 		}
 		tasks = append(tasks, &task)
 	}
 
+	if len(skipped) > 0 {
+		ctx, cancel := r.ackContext()
+		if err := r.ackTasks(ctx, minute, skipped...); err != nil {
+			log.Error("ack skipped tasks", slog.Any("error", err))
+		}
+		cancel()
+	}
+	for _, task := range exhausted {
+		ctx, cancel := r.ackContext()
+		r.exhaust(ctx, task)
+		cancel()
+	}
+	for _, task := range unsupported {
+		ctx, cancel := r.ackContext()
+		r.unsupported(ctx, task)
+		cancel()
+	}
 	return tasks, nil
 }
 
-// 获取定时任务有序表 key 的方法
-func (r *RTimeWheel) getMinuteSlice(executeAt time.Time) string {
-	return fmt.Sprintf("timewheel_task_{%s}", util.GetTimeMinuteStr(executeAt))
+// exhaust 取出次数超过上限的任务转入死信队列，并触发最终失败回调. 转入失败时任务留在处理中，租约过期后再次处理
+func (r *RTimeWheel) exhaust(ctx context.Context, task *RTaskElement) {
+	err := fmt.Errorf("%w: delivered %d times", ErrMaxDeliveries, task.deliveries)
+	log.Error("task exhausted", slog.Any("task key", task.Key), slog.Any("deliveries", task.deliveries))
+	if dlErr := r.deadLetter(ctx, task, err); dlErr != nil {
+		log.Error("dead letter err", dlErr.Error(), slog.Any("task key", task.Key))
+		return
+	}
+	r.counters.exhausted.Add(1)
+	r.retryPolicy(task.Type).finalFailure(task.Key, task.attempt(), err)
+}
+
+// unsupported 更高版本写入的任务转入死信队列. 转入失败时任务留在处理中，租约过期后再次处理
+func (r *RTimeWheel) unsupported(ctx context.Context, task *RTaskElement) {
+	err := fmt.Errorf("%w: version %d, supported up to %d", ErrUnsupportedVersion, task.Version, envelopeVersion)
+	log.Error("unsupported task version", slog.Any("task key", task.Key), slog.Any("version", task.Version))
+	if dlErr := r.deadLetter(ctx, task, err); dlErr != nil {
+		log.Error("dead letter err", dlErr.Error(), slog.Any("task key", task.Key))
+		return
+	}
+	r.counters.unsupported.Add(1)
+}
+
+// ackTasks 确认任务处理完成，将其从处理中移除
+func (r *RTimeWheel) ackTasks(ctx context.Context, executeAt time.Time, tasks ...backend.Task) error {
+	return r.backend.Ack(ctx, executeAt, tasks...)
 }
 
-// 获取删除任务集合 key 的方法
-func (r *RTimeWheel) getDeleteSetKey(executeAt time.Time) string {
-	return fmt.Sprintf("timewheel_delset_{%s}", util.GetTimeMinuteStr(executeAt))
+// leaseDeadline 以当前时间推算任务租约的到期时间
+func (r *RTimeWheel) leaseDeadline(now time.Time) time.Time {
+	return now.Add(r.visibilityTimeout)
 }
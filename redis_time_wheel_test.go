@@ -2,14 +2,25 @@ package timewheel
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/dej4vu/timewheel/internal/redistest"
+	"github.com/dej4vu/timewheel/pkg/backend"
+	"github.com/dej4vu/timewheel/pkg/backend/memory"
 	"github.com/dej4vu/timewheel/pkg/redis"
+	"github.com/dej4vu/timewheel/pkg/redis/fake"
 	"github.com/dej4vu/timewheel/pkg/redis/goredis"
 	"github.com/dej4vu/timewheel/pkg/redis/redigo"
 	"github.com/dej4vu/timewheel/pkg/util"
+	"github.com/demdxx/gocast"
 )
 
 func Test_LuaScript(t *testing.T) {
@@ -91,3 +102,614 @@ func run(t *testing.T, client redis.Store) {
 	<-time.After(6 * time.Second)
 	t.Log("ok")
 }
+
+func Test_RTimeWheel_Hooks(t *testing.T) {
+	ctx := context.Background()
+	var (
+		mu     sync.Mutex
+		events = make(map[string][]string)
+		errs   = make(map[string]error)
+	)
+	record := func(name string) func(HookEvent) {
+		return func(e HookEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			events[e.Key] = append(events[e.Key], name)
+			if e.Err != nil {
+				errs[e.Key] = e.Err
+			}
+		}
+	}
+
+	rTimeWheel := NewRTimeWheelWithBackend(memory.New(), func(ctx context.Context, task *RTaskElement) error {
+		if task.Key == "panic" {
+			panic("boom")
+		}
+		return nil
+	}, WithPollInterval(100*time.Millisecond), WithRHooks(Hooks{
+		OnAdd:     record("add"),
+		OnReplace: record("replace"),
+		OnRemove:  record("remove"),
+		OnFire:    record("fire"),
+		OnPanic:   record("panic"),
+	}))
+	defer rTimeWheel.Stop()
+
+	executeAt := time.Now().Add(300 * time.Millisecond)
+	for _, key := range []string{"fire", "replace", "overwrite", "remove", "remove_at", "panic"} {
+		at := executeAt
+		if key == "replace" {
+			at = executeAt.Add(time.Hour)
+		}
+		if err := rTimeWheel.AddTask(ctx, key, NewRTaskElement(key, "test"), at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rTimeWheel.Reschedule(ctx, "replace", executeAt); err != nil {
+		t.Fatal(err)
+	}
+	// 以相同 key 再次添加任务，覆盖已有任务
+	if err := rTimeWheel.AddTask(ctx, "overwrite", NewRTaskElement("overwrite2", "test"), executeAt); err != nil {
+		t.Fatal(err)
+	}
+	if err := rTimeWheel.RemoveTask(ctx, "remove"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rTimeWheel.RemoveTask(ctx, "remove_at", executeAt); err != nil {
+		t.Fatal(err)
+	}
+
+	<-time.After(time.Second)
+
+	mu.Lock()
+	defer mu.Unlock()
+	expects := map[string][]string{
+		"fire":      {"add", "fire"},
+		"replace":   {"add", "replace", "fire"},
+		"overwrite": {"add", "replace", "fire"},
+		"remove":    {"add", "remove"},
+		"remove_at": {"add", "remove"},
+		"panic":     {"add", "panic"},
+	}
+	for key, expect := range expects {
+		if got := events[key]; !reflect.DeepEqual(got, expect) {
+			t.Errorf("%s: got %v, expect %v", key, got, expect)
+		}
+	}
+	if len(errs) != 1 || errs["panic"] == nil {
+		t.Errorf("errors: got %v, expect only panic", errs)
+	}
+}
+
+func Test_RedisTimeWheel_AtLeastOnce(t *testing.T) {
+	ctx := context.Background()
+	client := goredis.NewClient(network, address, password)
+
+	var (
+		mu       sync.Mutex
+		attempts = make(map[string]int)
+	)
+	rTimeWheel := NewRTimeWheel(client, func(ctx context.Context, task *RTaskElement) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts[task.Key]++
+		// 首次处理失败的任务，在租约过期后会被重新执行
+		if task.Key == "fail_once" && attempts[task.Key] == 1 {
+			return errors.New("handle failed")
+		}
+		return nil
+	}, WithVisibilityTimeout(time.Second), WithReclaimWindow(2*time.Minute))
+	defer rTimeWheel.Stop()
+
+	for _, key := range []string{"fail_once", "succeed"} {
+		if err := rTimeWheel.AddTask(ctx, key, NewRTaskElement("msg", "test"), time.Now().Add(time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	<-time.After(5 * time.Second)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts["fail_once"] != 2 || attempts["succeed"] != 1 {
+		t.Errorf("unexpected attempts: %v", attempts)
+	}
+}
+
+func Test_RedisTimeWheel_DeadLetter(t *testing.T) {
+	ctx := context.Background()
+	client := goredis.NewClient(network, address, password)
+
+	var (
+		mu       sync.Mutex
+		attempts []int
+		final    = make(chan int, 1)
+	)
+	rTimeWheel := NewRTimeWheel(client, func(ctx context.Context, task *RTaskElement) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts = append(attempts, task.Attempt)
+		if task.Msg == "fail" {
+			return errors.New("handle failed")
+		}
+		return nil
+	}, WithRetryPolicy("dead_letter_test", &RetryPolicy{
+		MaxAttempts: 2,
+		OnFinalFailure: func(key string, attempt int, err error) {
+			final <- attempt
+		},
+	}))
+	defer rTimeWheel.Stop()
+
+	if _, err := rTimeWheel.PurgeDeadLetters(ctx, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := rTimeWheel.AddTask(ctx, "dead_letter", NewRTaskElement("fail", "dead_letter_test"), time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case attempt := <-final:
+		if attempt != 2 {
+			t.Errorf("final attempt: got %d, expect 2", attempt)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("final failure callback not called")
+	}
+
+	deadLetters, err := rTimeWheel.ListDeadLetters(ctx, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deadLetters) != 1 || deadLetters[0].Task.Key != "dead_letter" || deadLetters[0].Error != "handle failed" {
+		t.Fatalf("unexpected dead letters: %v", deadLetters)
+	}
+
+	// 重新挂载的死信从第 1 次执行开始计数
+	deadLetters[0].Task.Msg = "succeed"
+	if err := rTimeWheel.RequeueDeadLetter(ctx, deadLetters[0], time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	<-time.After(3 * time.Second)
+
+	if deadLetters, err = rTimeWheel.ListDeadLetters(ctx, 0, 10); err != nil || len(deadLetters) != 0 {
+		t.Errorf("dead letters after requeue: %v, %v", deadLetters, err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(attempts, []int{1, 2, 1}) {
+		t.Errorf("unexpected attempts: %v", attempts)
+	}
+}
+
+// 未设置重试策略时，持续失败的任务在取出次数超过上限后转入死信队列
+func Test_RedisTimeWheel_MaxDeliveries(t *testing.T) {
+	ctx := context.Background()
+	var executed atomic.Int32
+	rTimeWheel := NewRTimeWheel(fake.New(), func(ctx context.Context, task *RTaskElement) error {
+		executed.Add(1)
+		return errors.New("handle failed")
+	}, WithVisibilityTimeout(time.Second), WithMaxDeliveries(2), WithPollInterval(100*time.Millisecond))
+	defer rTimeWheel.Stop()
+
+	if err := rTimeWheel.AddTask(ctx, "exhausted", NewRTaskElement("fail", "test"), time.Now().Add(500*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	<-time.After(5 * time.Second)
+
+	if n := executed.Load(); n != 2 {
+		t.Errorf("executed %d times, want 2", n)
+	}
+	if stats := rTimeWheel.Stats(); stats.Exhausted != 1 {
+		t.Errorf("exhausted = %d, want 1", stats.Exhausted)
+	}
+	deadLetters, err := rTimeWheel.ListDeadLetters(ctx, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deadLetters) != 1 || deadLetters[0].Task.Key != "exhausted" || !strings.HasPrefix(deadLetters[0].Error, ErrMaxDeliveries.Error()) {
+		t.Fatalf("unexpected dead letters: %v", deadLetters)
+	}
+}
+
+func Test_RedisTimeWheel_CatchUp(t *testing.T) {
+	ctx := context.Background()
+	client := goredis.NewClient(network, address, password)
+
+	executed := make(chan string, 10)
+	rTimeWheel := NewRTimeWheel(client, func(ctx context.Context, task *RTaskElement) error {
+		executed <- task.Key
+		return nil
+	}, WithBatchSize(2))
+	defer rTimeWheel.Stop()
+
+	// 模拟所有实例宕机：水位停留在 90s 之前，期间到期的任务均未被扫描
+	missedAt := time.Now().Add(-80 * time.Second)
+	if _, err := client.Eval(ctx, "return redis.call('set', KEYS[1], ARGV[1])",
+		[]string{redis.WatermarkKey}, []interface{}{time.Now().Add(-90 * time.Second).UnixMilli()}); err != nil {
+		t.Fatal(err)
+	}
+	expects := make(map[string]bool)
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("catch_up_%d", i)
+		task := NewRTaskElement("msg", "test")
+		task.Key = key
+		if _, err := rTimeWheel.addTask(ctx, task, missedAt.Add(time.Duration(i)*10*time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		expects[key] = true
+	}
+
+	timeout := time.After(3 * time.Second)
+	for len(expects) > 0 {
+		select {
+		case key := <-executed:
+			delete(expects, key)
+		case <-timeout:
+			t.Fatalf("tasks not caught up: %v", expects)
+		}
+	}
+
+	// 等待本轮扫描结束
+	<-time.After(time.Second)
+	watermark, err := rTimeWheel.getWatermark(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(watermark) > 3*time.Second {
+		t.Errorf("watermark not advanced: %v", watermark)
+	}
+}
+
+func Test_RedisTimeWheel_Millisecond(t *testing.T) {
+	ctx := context.Background()
+	client := goredis.NewClient(network, address, password)
+
+	type fired struct {
+		task    *RTaskElement
+		firedAt time.Time
+	}
+	firedc := make(chan fired, 2)
+	rTimeWheel := NewRTimeWheel(client, func(ctx context.Context, task *RTaskElement) error {
+		firedc <- fired{task: task, firedAt: time.Now()}
+		return nil
+	}, WithPollInterval(50*time.Millisecond))
+	defer rTimeWheel.Stop()
+
+	executeAt := time.Now().Add(300 * time.Millisecond)
+	if err := rTimeWheel.AddTask(ctx, "millisecond", NewRTaskElement("msg", "test"), executeAt); err != nil {
+		t.Fatal(err)
+	}
+
+	// 历史版本写入的任务以秒级时间戳作为 score，且不包含毫秒级执行时间
+	legacyAt := time.Now().Add(time.Second)
+	legacyBody := fmt.Sprintf(`{"key":"legacy","msg":"msg","type":"test","executeAtUnix":%d}`, legacyAt.Unix())
+	if _, err := client.Eval(ctx, redis.AddTaskLuaScript,
+		[]string{redis.MinuteSliceKey(legacyAt), redis.DeleteSetKey(legacyAt)},
+		[]interface{}{legacyAt.Unix(), legacyBody, "legacy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case f := <-firedc:
+			switch f.task.Key {
+			case "millisecond":
+				if lateness := f.firedAt.Sub(executeAt); lateness < 0 || lateness > 200*time.Millisecond {
+					t.Errorf("unexpected lateness: %v", lateness)
+				}
+			case "legacy":
+				if !f.task.ExecuteAt().Equal(time.Unix(legacyAt.Unix(), 0)) {
+					t.Errorf("unexpected legacy executeAt: %v", f.task.ExecuteAt())
+				}
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatal("task not fired")
+		}
+	}
+}
+
+func Test_RedisTimeWheel_Distribution(t *testing.T) {
+	ctx := context.Background()
+	client := goredis.NewClient(network, address, password)
+
+	// 模拟 3 个实例，每个实例 2 个 worker
+	wheels := make([]*RTimeWheel, 0, 3)
+	for i := 0; i < 3; i++ {
+		rTimeWheel := NewRTimeWheel(client, func(ctx context.Context, task *RTaskElement) error {
+			<-time.After(100 * time.Millisecond)
+			return nil
+		}, WithWorkers(2), WithPollInterval(50*time.Millisecond))
+		defer rTimeWheel.Stop()
+		wheels = append(wheels, rTimeWheel)
+	}
+
+	const taskNum = 30
+	executeAt := time.Now().Add(time.Second)
+	for i := 0; i < taskNum; i++ {
+		if err := wheels[0].AddTask(ctx, fmt.Sprintf("distribution_%d", i), NewRTaskElement("msg", "test"), executeAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	<-time.After(3 * time.Second)
+
+	var total uint64
+	for i, rTimeWheel := range wheels {
+		stats := rTimeWheel.Stats()
+		t.Logf("instance %d: %+v", i, stats)
+		// 单个实例同一时刻最多执行 2 笔任务，无法独占全部任务
+		if stats.Executed == 0 || stats.Executed > taskNum/2 {
+			t.Errorf("instance %d executed %d tasks", i, stats.Executed)
+		}
+		total += stats.Executed
+	}
+	if total != taskNum {
+		t.Errorf("executed %d tasks, expect %d", total, taskNum)
+	}
+}
+
+func Test_RedisTimeWheel_LeaderElection(t *testing.T) {
+	client := goredis.NewClient(network, address, password)
+
+	type change struct {
+		id       string
+		isLeader bool
+		token    int64
+	}
+	changes := make(chan change, 10)
+	newWheel := func(id string) *RTimeWheel {
+		return NewRTimeWheel(client, handle,
+			WithConsumerID(id),
+			WithLeaderElection(600*time.Millisecond),
+			WithLeadershipHandler(func(isLeader bool, token int64) {
+				changes <- change{id: id, isLeader: isLeader, token: token}
+			}))
+	}
+
+	first := newWheel("leader_1")
+	defer first.Stop()
+	<-time.After(100 * time.Millisecond)
+	second := newWheel("leader_2")
+	defer second.Stop()
+
+	elected := <-changes
+	if elected.id != "leader_1" || !elected.isLeader || !first.IsLeader() || second.IsLeader() {
+		t.Fatalf("unexpected leadership: %+v", elected)
+	}
+
+	// leader 停止后主动释放租约，由另一个实例接管，fencing token 递增
+	first.Stop()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case c := <-changes:
+			if c.id != "leader_2" {
+				continue
+			}
+			if !c.isLeader || c.token <= elected.token || !second.IsLeader() {
+				t.Errorf("unexpected failover: %+v", c)
+			}
+			return
+		case <-timeout:
+			t.Fatal("leadership not taken over")
+		}
+	}
+}
+
+func Test_ScriptRun(t *testing.T) {
+	for name, client := range map[string]redis.Store{
+		"redigo":  redigo.NewClient(network, address, password),
+		"goredis": goredis.NewClient(network, address, password),
+	} {
+		ctx := context.Background()
+		// 内容唯一的脚本，保证 redis 中尚未缓存
+		script := redis.NewScript(fmt.Sprintf("-- %s %d\nreturn ARGV[1]", name, time.Now().UnixNano()))
+		if _, err := client.EvalSha(ctx, script.Hash(), nil, []interface{}{"ok"}); !redis.IsNoScript(err) {
+			t.Fatalf("%s: got %v, expect NOSCRIPT error", name, err)
+		}
+
+		// 回退到 EVAL 执行后，脚本被 redis 缓存
+		if reply, err := script.Run(ctx, client, nil, []interface{}{"ok"}); err != nil || gocast.ToString(reply) != "ok" {
+			t.Fatalf("%s: run script: %v, %v", name, reply, err)
+		}
+		if reply, err := client.EvalSha(ctx, script.Hash(), nil, []interface{}{"ok"}); err != nil || gocast.ToString(reply) != "ok" {
+			t.Fatalf("%s: evalsha: %v, %v", name, reply, err)
+		}
+
+		sha, err := client.ScriptLoad(ctx, redis.AddTaskLuaScript)
+		if err != nil || sha != redis.AddTaskScript.Hash() {
+			t.Errorf("%s: script load: %s, %v", name, sha, err)
+		}
+	}
+}
+
+func Test_ClusterKeySlots(t *testing.T) {
+	for _, minute := range []time.Time{
+		time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local),
+		time.Now(),
+		time.Now().Add(37 * time.Minute),
+	} {
+		slot := redistest.KeySlot(redis.MinuteSliceKey(minute))
+		for _, key := range []string{redis.DeleteSetKey(minute), redis.ProcessingKey(minute)} {
+			if got := redistest.KeySlot(key); got != slot {
+				t.Errorf("key %s slot = %d, want %d", key, got, slot)
+			}
+		}
+	}
+
+	if redistest.KeySlot(redis.LeaderKey) != redistest.KeySlot(redis.LeaderTokenKey) {
+		t.Errorf("leader keys should be in the same slot")
+	}
+}
+
+func Test_RedisTimeWheel_Cluster(t *testing.T) {
+	addrs := redistest.StartCluster(t, 3)
+	client := goredis.NewClusterClient(addrs, "")
+	defer client.Close()
+	testCluster(t, client)
+}
+
+// Test_RedisTimeWheel_FakeCluster 在模拟 redis cluster 的进程内存储上执行，跨 slot 访问 key 时返回 CROSSSLOT 错误
+func Test_RedisTimeWheel_FakeCluster(t *testing.T) {
+	testCluster(t, fake.NewCluster())
+}
+
+// testCluster 在 cluster 模式下添加、删除并执行任务. 不设置 hash tag，时间片按照分钟分散在各个 slot 中
+func testCluster(t *testing.T, client redis.Store) {
+	ctx := context.Background()
+	var (
+		mu       sync.Mutex
+		executed = make(map[string]int)
+	)
+	rTimeWheel := NewRTimeWheelWithBackend(mustNewBackend(t, client, redis.WithoutKeyIndex()), func(ctx context.Context, task *RTaskElement) error {
+		mu.Lock()
+		executed[task.Key]++
+		mu.Unlock()
+		return nil
+	})
+	defer rTimeWheel.Stop()
+
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("cluster_%d", i)
+		if err := rTimeWheel.AddTask(ctx, key, NewRTaskElement("msg", "test"), now.Add(time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rTimeWheel.RemoveTask(ctx, "cluster_0", now.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	<-time.After(4 * time.Second)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if executed["cluster_0"] != 0 {
+		t.Errorf("removed task should not be executed")
+	}
+	for i := 1; i < 5; i++ {
+		if key := fmt.Sprintf("cluster_%d", i); executed[key] != 1 {
+			t.Errorf("task %s executed %d times, want 1", key, executed[key])
+		}
+	}
+}
+
+func Test_ClientOptions(t *testing.T) {
+	ctx := context.Background()
+	for name, newClient := range map[string]func(opts ...redis.ClientOption) redis.Store{
+		"redigo": func(opts ...redis.ClientOption) redis.Store {
+			return redigo.NewClient(network, address, password, opts...)
+		},
+		"goredis": func(opts ...redis.ClientOption) redis.Store {
+			return goredis.NewClient(network, address, password, opts...)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			key := fmt.Sprintf("timewheel_test_options_%s_%d", name, time.Now().UnixNano())
+			scard := "local n = redis.call('scard', KEYS[1]); redis.call('del', KEYS[1]); return n"
+
+			db1 := newClient(redis.WithDB(1), redis.WithClientName("timewheel-test"),
+				redis.WithDialTimeout(time.Second), redis.WithReadTimeout(time.Second), redis.WithWriteTimeout(time.Second))
+			if _, err := db1.SAdd(ctx, key, "v"); err != nil {
+				t.Fatal(err)
+			}
+
+			// 默认 DB 中不应该存在该 key
+			n, err := newClient().Eval(ctx, scard, []string{key}, nil)
+			if err != nil || gocast.ToInt(n) != 0 {
+				t.Errorf("db 0 scard = %v, %v, want 0", n, err)
+			}
+			n, err = db1.Eval(ctx, scard, []string{key}, nil)
+			if err != nil || gocast.ToInt(n) != 1 {
+				t.Errorf("db 1 scard = %v, %v, want 1", n, err)
+			}
+		})
+	}
+}
+
+func Test_RedisTimeWheel_Health(t *testing.T) {
+	ctx := context.Background()
+	client := goredis.NewClient(network, address, password)
+	defer client.Close()
+	if err := client.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	rTimeWheel := NewRTimeWheel(client, handle, WithPollInterval(100*time.Millisecond))
+	defer rTimeWheel.Stop()
+
+	<-time.After(time.Second)
+	if health := rTimeWheel.Health(); !health.Healthy(time.Second) || health.LastScan.IsZero() {
+		t.Errorf("health = %+v, want healthy", health)
+	}
+
+	// redis 不可用时，连续扫描失败
+	unreachable := redigo.NewClient(network, "localhost:1", password)
+	if err := unreachable.Ping(ctx); err == nil {
+		t.Fatal("ping unreachable redis should fail")
+	}
+	rTimeWheel2 := NewRTimeWheel(unreachable, handle, WithPollInterval(100*time.Millisecond))
+	defer rTimeWheel2.Stop()
+
+	<-time.After(time.Second)
+	if health := rTimeWheel2.Health(); health.Healthy(0) || health.ConsecutiveFailures < 2 || health.LastError == nil {
+		t.Errorf("health = %+v, want unhealthy", health)
+	}
+
+	if err := unreachable.Close(); err != nil {
+		t.Error(err)
+	}
+	if err := unreachable.Ping(ctx); err == nil {
+		t.Error("ping closed client should fail")
+	}
+}
+
+// deadlineBackend 与网络存储一致，ctx 超时后推进水位失败
+type deadlineBackend struct {
+	backend.Backend
+}
+
+func (b deadlineBackend) AdvanceWatermark(ctx context.Context, watermark time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.Backend.AdvanceWatermark(ctx, watermark)
+}
+
+// Test_RTimeWheel_SlowWorkers worker 繁忙时等待的时长超过租约时长，扫描仍然成功完成并推进水位
+func Test_RTimeWheel_SlowWorkers(t *testing.T) {
+	ctx := context.Background()
+	var executed atomic.Int32
+	// 轮询间隔足够长，只通过手动调用 scan 扫描
+	rTimeWheel := NewRTimeWheelWithBackend(deadlineBackend{memory.New()}, func(ctx context.Context, task *RTaskElement) error {
+		<-time.After(300 * time.Millisecond)
+		executed.Add(1)
+		return nil
+	}, WithPollInterval(time.Hour), WithVisibilityTimeout(500*time.Millisecond), WithWorkers(1), WithBatchSize(1))
+	defer rTimeWheel.Stop()
+
+	for i := 0; i < 4; i++ {
+		key := fmt.Sprintf("slow_%d", i)
+		if err := rTimeWheel.AddTask(ctx, key, NewRTaskElement(key, "test"), time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := time.Now()
+	watermark, err := rTimeWheel.scan()
+	if err != nil {
+		t.Fatalf("scan err = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 500*time.Millisecond {
+		t.Errorf("scan took %v, want longer than the visibility timeout", elapsed)
+	}
+	if got, err := rTimeWheel.getWatermark(ctx); err != nil || !got.Equal(watermark) {
+		t.Errorf("watermark = %v, %v, want %v", got, err, watermark)
+	}
+
+	<-time.After(500 * time.Millisecond)
+	if got := executed.Load(); got != 4 {
+		t.Errorf("executed %d tasks, want 4", got)
+	}
+}
@@ -0,0 +1,60 @@
+package timewheel
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy 任务执行失败后的重试策略
+type RetryPolicy struct {
+	// 最大执行次数（包含首次执行），小于等于 1 时不重试
+	MaxAttempts int
+	// 首次重试前的退避时间
+	InitialBackoff time.Duration
+	// 退避时间上限，为 0 时不设上限
+	MaxBackoff time.Duration
+	// 每次重试退避时间的增长倍数，小于 1 时按 2 处理
+	Multiplier float64
+	// 抖动比例，取值 [0, 1]. 实际退避时间在 backoff*(1-Jitter) 到 backoff*(1+Jitter) 之间随机
+	Jitter float64
+	// 判断错误是否可重试，为空时所有错误均可重试
+	Retryable func(err error) bool
+	// 重试次数耗尽或错误不可重试时的回调，attempt 为最后一次执行的次数
+	OnFinalFailure func(key string, attempt int, err error)
+}
+
+// Backoff 计算第 attempt 次执行失败后，距离下一次执行的退避时间
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	backoff := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	if jitter := math.Min(math.Max(p.Jitter, 0), 1); jitter > 0 {
+		backoff *= 1 - jitter + 2*jitter*rand.Float64()
+	}
+	return time.Duration(backoff)
+}
+
+// shouldRetry 判断第 attempt 次执行失败后是否需要重试
+func (p *RetryPolicy) shouldRetry(attempt int, err error) bool {
+	if p == nil || attempt >= p.MaxAttempts {
+		return false
+	}
+	return p.Retryable == nil || p.Retryable(err)
+}
+
+// finalFailure 触发最终失败回调
+func (p *RetryPolicy) finalFailure(key string, attempt int, err error) {
+	if p != nil && p.OnFinalFailure != nil {
+		p.OnFinalFailure(key, attempt, err)
+	}
+}
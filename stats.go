@@ -0,0 +1,141 @@
+package timewheel
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats 单机版时间轮运行指标快照
+type Stats struct {
+	// 待执行的任务数量
+	Pending int
+	// 待执行任务的数量上限，为 0 时不限制
+	MaxTasks int
+	// 待执行任务数量占上限的比例，未设置上限时为 0
+	Utilization float64
+	// 各个 slot 中挂载的任务数量
+	Slots []int
+	// 当前遍历到的环状数组的索引
+	CurSlot int
+	// 时间轮运行时间间隔
+	Interval time.Duration
+	// 执行成功的任务数量
+	Executed uint64
+	// 执行返回错误的次数
+	Failed uint64
+	// 失败后重新挂载的次数
+	Retried uint64
+	// 被主动删除的任务数量
+	Removed uint64
+	// 被相同 key 覆盖的任务数量
+	Replaced uint64
+	// 执行时发生 panic 的任务数量
+	Panicked uint64
+	// 因容量不足被淘汰的任务数量
+	Evicted uint64
+	// 因容量不足被拒绝的添加次数
+	Rejected uint64
+	// 任务实际触发时间与预期执行时间之差的分布. 调整时间轮规格后重新统计
+	Lateness Histogram
+}
+
+// Histogram 直方图快照
+type Histogram struct {
+	// 各个桶的上界（包含），按升序排列
+	Bounds []time.Duration
+	// 各个桶的样本数. 长度比 Bounds 多 1，最后一个桶统计超出最大上界的样本
+	Counts []uint64
+}
+
+// Total 样本总数
+func (h Histogram) Total() uint64 {
+	var total uint64
+	for _, cnt := range h.Counts {
+		total += cnt
+	}
+	return total
+}
+
+// histogram 并发安全的直方图
+type histogram struct {
+	bounds []time.Duration
+	counts []atomic.Uint64
+}
+
+func newHistogram(bounds []time.Duration) *histogram {
+	return &histogram{
+		bounds: bounds,
+		counts: make([]atomic.Uint64, len(bounds)+1),
+	}
+}
+
+// latenessBounds 以时间轮的扫描间隔为基准，推算延迟直方图的分桶
+func latenessBounds(interval time.Duration) []time.Duration {
+	return []time.Duration{0, interval / 2, interval, 2 * interval, 5 * interval, 10 * interval}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	i := 0
+	for ; i < len(h.bounds); i++ {
+		if d <= h.bounds[i] {
+			break
+		}
+	}
+	h.counts[i].Add(1)
+}
+
+func (h *histogram) snapshot() Histogram {
+	s := Histogram{
+		Bounds: append([]time.Duration(nil), h.bounds...),
+		Counts: make([]uint64, len(h.counts)),
+	}
+	for i := range h.counts {
+		s.Counts[i] = h.counts[i].Load()
+	}
+	return s
+}
+
+// counters 时间轮的累计计数器
+type counters struct {
+	executed atomic.Uint64
+	removed  atomic.Uint64
+	replaced atomic.Uint64
+	panicked atomic.Uint64
+	failed   atomic.Uint64
+	retried  atomic.Uint64
+	evicted  atomic.Uint64
+	rejected atomic.Uint64
+}
+
+// RStats redis 版时间轮在当前实例上的运行指标快照
+type RStats struct {
+	// 并发执行任务的 worker 数量，为 0 时不限制
+	Workers int
+	// 正在执行任务的 worker 数量
+	Busy int
+	// 到期后取出的任务数量
+	Claimed uint64
+	// 租约过期后回收的任务数量
+	Reclaimed uint64
+	// 执行成功的任务数量
+	Executed uint64
+	// 执行失败的次数
+	Failed uint64
+	// 执行时发生 panic 的次数
+	Panicked uint64
+	// 取出次数超过上限后转入死信队列的任务数量
+	Exhausted uint64
+	// 由更高版本写入、无法处理而转入死信队列的任务数量
+	Unsupported uint64
+}
+
+// rcounters redis 版时间轮的累计计数器
+type rcounters struct {
+	claimed     atomic.Uint64
+	reclaimed   atomic.Uint64
+	executed    atomic.Uint64
+	failed      atomic.Uint64
+	panicked    atomic.Uint64
+	exhausted   atomic.Uint64
+	unsupported atomic.Uint64
+}
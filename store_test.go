@@ -0,0 +1,57 @@
+package timewheel
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dej4vu/timewheel/internal/redistest"
+	"github.com/dej4vu/timewheel/pkg/redis"
+	"github.com/dej4vu/timewheel/pkg/redis/fake"
+	"github.com/dej4vu/timewheel/pkg/redis/goredis"
+	"github.com/dej4vu/timewheel/pkg/redis/redigo"
+	"github.com/dej4vu/timewheel/pkg/redis/storetest"
+)
+
+func Test_Store_Fake(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) redis.Store {
+		return fake.New()
+	})
+}
+
+func Test_Store_FakeCluster(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) redis.Store {
+		return fake.NewCluster()
+	})
+
+	// 与 redis cluster 一致，脚本访问的 key 不在同一个 slot 时返回 CROSSSLOT 错误
+	_, err := fake.NewCluster().Eval(context.Background(), "return 1",
+		[]string{redis.TaskIndexKey, redis.MinuteSliceKey(time.Now())}, nil)
+	if err == nil || !strings.HasPrefix(err.Error(), "CROSSSLOT") {
+		t.Errorf("cross slot err = %v, want CROSSSLOT", err)
+	}
+}
+
+func Test_Store_Redigo(t *testing.T) {
+	addr := redistest.StartServer(t)
+	storetest.Run(t, func(t *testing.T) redis.Store {
+		return newTestStore(t, redigo.NewClient(network, addr, ""))
+	})
+}
+
+func Test_Store_Goredis(t *testing.T) {
+	addr := redistest.StartServer(t)
+	storetest.Run(t, func(t *testing.T) redis.Store {
+		return newTestStore(t, goredis.NewClient(network, addr, ""))
+	})
+}
+
+// newTestStore 清空 redis 中的数据，并在测试结束时关闭 Store
+func newTestStore(t *testing.T, store redis.Store) redis.Store {
+	t.Cleanup(func() { _ = store.Close() })
+	if _, err := store.Eval(context.Background(), "return redis.call('flushdb')", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
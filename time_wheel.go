@@ -2,15 +2,31 @@ package timewheel
 
 import (
 	"container/list"
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// ErrStopped 时间轮已停止
+var ErrStopped = errors.New("timewheel: stopped")
+
 // taskElement 封装了一笔定时任务的明细信息
 type taskElement struct {
-	// 任务执行函数
-	task func()
+	// 任务执行函数，入参为当前的执行次数，从 1 开始
+	task func(attempt int) error
+
+	// 当前的执行次数
+	attempt int
+
+	// 任务失败后的重试策略
+	policy *RetryPolicy
+
+	// 是否为失败重试时重新挂载的任务
+	retry bool
 
 	// 定时任务挂载在环状数组中的索引位置
 	pos int
@@ -20,6 +36,12 @@ type taskElement struct {
 
 	// 定时任务的唯一标识键
 	key string
+
+	// 定时任务预期的执行时间
+	executeAt time.Time
+
+	// 在执行时间堆中的索引
+	heapIdx int
 }
 
 // TimeWheel 时间轮
@@ -37,7 +59,7 @@ type TimeWheel struct {
 	stopc chan struct{}
 
 	// 新增定时任务的入口 channel
-	addTaskCh chan *taskElement
+	addTaskCh chan *addRequest
 
 	// 删除定时任务的入口 channel
 	removeTaskCh chan string
@@ -51,12 +73,53 @@ type TimeWheel struct {
 
 	// 定时任务 key 到任务节点的映射，便于在 list 中删除任务节点
 	keyToETask map[string]*list.Element
+
+	// 生命周期回调
+	hooks *Hooks
+
+	// 获取运行指标快照的入口 channel
+	statsCh chan chan Stats
+
+	// 调整时间轮规格的入口 channel
+	resizeCh chan *resizeRequest
+
+	// 累计计数器
+	counters counters
+
+	// 任务触发延迟的直方图，分桶随轮询时间间隔调整
+	lateness atomic.Pointer[histogram]
+
+	// 待执行任务的数量上限，小于等于 0 时不限制
+	maxTasks int
+
+	// 任务数量达到上限时的处理策略
+	overflow OverflowPolicy
+
+	// 按照执行时间排序的任务堆，仅在淘汰策略下使用
+	deadlines *deadlineHeap
+
+	// 阻塞策略下，任务数量减少时关闭的 channel，用于唤醒等待方
+	freec chan struct{}
+}
+
+// addRequest 新增定时任务的请求
+type addRequest struct {
+	task    *taskElement
+	resultc chan addResult
+}
+
+// addResult 新增定时任务的结果
+type addResult struct {
+	// 阻塞策略下，容量释放时关闭的 channel
+	wait <-chan struct{}
+	err  error
 }
 
 // NewTimeWheel 新建时间轮
 // slotNum 环状数组长度
 // interval 轮询时间间隔
-func NewTimeWheel(slotNum int, interval time.Duration) *TimeWheel {
+// opts 可选配置
+func NewTimeWheel(slotNum int, interval time.Duration, opts ...Option) *TimeWheel {
 	// 环状数组长度默认为 10
 	if slotNum <= 0 {
 		slotNum = 10
@@ -73,15 +136,22 @@ func NewTimeWheel(slotNum int, interval time.Duration) *TimeWheel {
 		stopc:        make(chan struct{}),
 		keyToETask:   make(map[string]*list.Element),
 		slots:        make([]*list.List, 0, slotNum),
-		addTaskCh:    make(chan *taskElement),
+		addTaskCh:    make(chan *addRequest),
 		removeTaskCh: make(chan string),
+		statsCh:      make(chan chan Stats),
+		resizeCh:     make(chan *resizeRequest),
 	}
+	t.lateness.Store(newHistogram(latenessBounds(interval)))
 
 	// 初始化数据槽
 	for i := 0; i < slotNum; i++ {
 		t.slots = append(t.slots, list.New())
 	}
 
+	for _, opt := range opts {
+		opt(&t)
+	}
+
 	// 异步启动时间轮常驻 goroutine
 	go t.run()
 	return &t
@@ -96,19 +166,108 @@ func (t *TimeWheel) Stop() {
 }
 
 // AddTask 添加任务到时间轮
-func (t *TimeWheel) AddTask(key string, task func(), executeAt time.Time) {
-	pos, cycle := t.getPosAndCircle(executeAt)
-	t.addTaskCh <- &taskElement{
-		pos:   pos,
-		cycle: cycle,
-		task:  task,
-		key:   key,
+func (t *TimeWheel) AddTask(key string, task func(), executeAt time.Time) error {
+	return t.AddTaskContext(context.Background(), key, task, executeAt)
+}
+
+// AddTaskContext 添加任务到时间轮，ctx 用于控制 OverflowBlock 策略下的等待时间
+func (t *TimeWheel) AddTaskContext(ctx context.Context, key string, task func(), executeAt time.Time) error {
+	return t.AddRetryTask(ctx, key, func(int) error {
+		task()
+		return nil
+	}, executeAt, nil)
+}
+
+// AddRetryTask 添加可重试的任务到时间轮
+// 任务返回错误时，按照 policy 计算退避时间，以相同 key 重新挂载到时间轮中
+// 重试期间若以相同 key 添加了新任务，则放弃重试
+func (t *TimeWheel) AddRetryTask(ctx context.Context, key string, task func(attempt int) error, executeAt time.Time, policy *RetryPolicy) error {
+	return t.add(ctx, &taskElement{
+		task:      task,
+		key:       key,
+		executeAt: executeAt,
+		attempt:   1,
+		policy:    policy,
+	})
+}
+
+// add 将任务投递到时间轮常驻 goroutine，在 OverflowBlock 策略下等待容量释放后重新投递
+func (t *TimeWheel) add(ctx context.Context, task *taskElement) error {
+	for {
+		req := addRequest{
+			task:    task,
+			resultc: make(chan addResult, 1),
+		}
+		select {
+		case t.addTaskCh <- &req:
+		case <-t.stopc:
+			return ErrStopped
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		result := <-req.resultc
+		if result.wait == nil {
+			return result.err
+		}
+		select {
+		case <-result.wait:
+		case <-t.stopc:
+			return ErrStopped
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
 }
 
 // RemoveTask 从时间轮移除任务
 func (t *TimeWheel) RemoveTask(key string) {
-	t.removeTaskCh <- key
+	select {
+	case t.removeTaskCh <- key:
+	case <-t.stopc:
+	}
+}
+
+// resizeRequest 调整时间轮规格的请求
+type resizeRequest struct {
+	slotNum  int
+	interval time.Duration
+	done     chan struct{}
+}
+
+// Resize 调整时间轮的环状数组长度与轮询时间间隔
+// 所有待执行的任务按照原有的执行时间重新挂载，调整操作在时间轮常驻 goroutine 中原子完成
+// 延迟直方图按照新的时间间隔重新分桶，并清空已有的样本
+func (t *TimeWheel) Resize(slotNum int, interval time.Duration) error {
+	if slotNum <= 0 || interval <= 0 {
+		return fmt.Errorf("slotNum:%d, interval:%v should be positive", slotNum, interval)
+	}
+
+	req := resizeRequest{
+		slotNum:  slotNum,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+	select {
+	case t.resizeCh <- &req:
+		<-req.done
+		return nil
+	case <-t.stopc:
+		return ErrStopped
+	}
+}
+
+// Stats 获取时间轮的运行指标快照. 时间轮停止后，仅返回累计计数器与延迟直方图
+func (t *TimeWheel) Stats() Stats {
+	statsc := make(chan Stats, 1)
+	select {
+	case t.statsCh <- statsc:
+		return <-statsc
+	case <-t.stopc:
+		stats := Stats{}
+		t.fillCounters(&stats)
+		return stats
+	}
 }
 
 // 运行时间轮
@@ -131,11 +290,18 @@ func (t *TimeWheel) run() {
 			// 批量执行定时任务
 			t.tick()
 		// 接收创建定时任务的信号
-		case task := <-t.addTaskCh:
-			t.addTask(task)
+		case req := <-t.addTaskCh:
+			req.resultc <- t.addTask(req.task)
 		// 接收到删除定时任务的信号
 		case removeKey := <-t.removeTaskCh:
 			t.removeTask(removeKey)
+		// 接收到获取运行指标的信号
+		case statsc := <-t.statsCh:
+			statsc <- t.stats()
+		// 接收到调整时间轮规格的信号
+		case req := <-t.resizeCh:
+			t.resize(req.slotNum, req.interval)
+			close(req.done)
 		}
 	}
 }
@@ -157,47 +323,181 @@ func (t *TimeWheel) execute(l *list.List) {
 		}
 
 		// 执行任务
-		go func() {
-			defer func() {
-				if err := recover(); err != nil {
-					// ...
-				}
-			}()
-			taskElement.task()
-		}()
+		go t.fire(taskElement)
 
 		// 执行任务后，从时间轮中删除
 		next := e.Next()
 		l.Remove(e)
 		delete(t.keyToETask, taskElement.key)
+		t.deadlines.remove(taskElement)
+		t.release()
 		e = next
 	}
 }
 
+// fire 执行单笔任务，并通过回调上报执行结果
+func (t *TimeWheel) fire(task *taskElement) {
+	event := HookEvent{
+		Key:       task.key,
+		ExecuteAt: task.executeAt,
+		FiredAt:   time.Now(),
+	}
+	t.lateness.Load().observe(event.FiredAt.Sub(task.executeAt))
+	defer func() {
+		if err := recover(); err != nil {
+			t.counters.panicked.Add(1)
+			event.Err = fmt.Errorf("panic: %v", err)
+			log.Error("task panic", slog.Any("task key", task.key), slog.Any("error", err))
+			t.hooks.panic(event)
+		}
+	}()
+	err := task.task(task.attempt)
+	event.Err = err
+	if err == nil {
+		t.counters.executed.Add(1)
+	} else {
+		t.counters.failed.Add(1)
+	}
+	t.hooks.fire(event)
+	if err != nil {
+		t.retry(task, err)
+	}
+}
+
+// retry 任务执行失败后，根据重试策略决定重新挂载任务或者触发最终失败回调
+func (t *TimeWheel) retry(task *taskElement, err error) {
+	if !task.policy.shouldRetry(task.attempt, err) {
+		task.policy.finalFailure(task.key, task.attempt, err)
+		return
+	}
+
+	retryTask := &taskElement{
+		task:      task.task,
+		key:       task.key,
+		executeAt: time.Now().Add(task.policy.Backoff(task.attempt)),
+		attempt:   task.attempt + 1,
+		policy:    task.policy,
+		retry:     true,
+	}
+	switch addErr := t.add(context.Background(), retryTask); {
+	case addErr == nil:
+		t.counters.retried.Add(1)
+	case errors.Is(addErr, ErrFull):
+		task.policy.finalFailure(task.key, task.attempt, fmt.Errorf("%w: %w", addErr, err))
+	}
+}
+
+// stats 生成运行指标快照，需要在时间轮常驻 goroutine 中调用
+func (t *TimeWheel) stats() Stats {
+	stats := Stats{
+		Pending:  len(t.keyToETask),
+		Slots:    make([]int, len(t.slots)),
+		CurSlot:  t.curSlot,
+		Interval: t.interval,
+		MaxTasks: t.maxTasks,
+	}
+	if t.maxTasks > 0 {
+		stats.Utilization = float64(stats.Pending) / float64(t.maxTasks)
+	}
+	for i, l := range t.slots {
+		stats.Slots[i] = l.Len()
+	}
+	t.fillCounters(&stats)
+	return stats
+}
+
+func (t *TimeWheel) fillCounters(stats *Stats) {
+	stats.Executed = t.counters.executed.Load()
+	stats.Removed = t.counters.removed.Load()
+	stats.Replaced = t.counters.replaced.Load()
+	stats.Panicked = t.counters.panicked.Load()
+	stats.Failed = t.counters.failed.Load()
+	stats.Retried = t.counters.retried.Load()
+	stats.Evicted = t.counters.evicted.Load()
+	stats.Rejected = t.counters.rejected.Load()
+	stats.Lateness = t.lateness.Load().snapshot()
+}
+
+// resize 将全部任务摘出后，按照新的规格重新挂载
+func (t *TimeWheel) resize(slotNum int, interval time.Duration) {
+	tasks := make([]*taskElement, 0, len(t.keyToETask))
+	for _, l := range t.slots {
+		for e := l.Front(); e != nil; e = e.Next() {
+			tasks = append(tasks, e.Value.(*taskElement))
+		}
+	}
+
+	t.slots = make([]*list.List, 0, slotNum)
+	for i := 0; i < slotNum; i++ {
+		t.slots = append(t.slots, list.New())
+	}
+	t.curSlot = 0
+	t.interval = interval
+	t.ticker.Reset(interval)
+	// 原有样本的分桶基于旧的时间间隔，无法换算到新的分桶
+	t.lateness.Store(newHistogram(latenessBounds(interval)))
+
+	for _, task := range tasks {
+		task.pos, task.cycle = t.getPosAndCircle(task.executeAt)
+		t.keyToETask[task.key] = t.slots[task.pos].PushBack(task)
+	}
+}
+
 func (t *TimeWheel) getPosAndCircle(executeAt time.Time) (int, int) {
-	delay := int(time.Until(executeAt))
+	// 已到期的任务挂载到当前位置，在下一次 tick 时执行
+	delay := max(int(time.Until(executeAt)), 0)
 	cycle := delay / (len(t.slots) * int(t.interval))
 	pos := (t.curSlot + delay/int(t.interval)) % len(t.slots)
 	return pos, cycle
 }
 
-func (t *TimeWheel) addTask(task *taskElement) {
+func (t *TimeWheel) addTask(task *taskElement) addResult {
+	// 重试期间已经以相同 key 添加了新任务，以新任务为准
+	if _, ok := t.keyToETask[task.key]; ok && task.retry {
+		return addResult{}
+	}
+	if wait, err := t.admit(task); err != nil {
+		return addResult{wait: wait, err: err}
+	}
+
+	// 在常驻 goroutine 中根据 curSlot 推算任务的挂载位置
+	task.pos, task.cycle = t.getPosAndCircle(task.executeAt)
 	list := t.slots[task.pos]
+	event := HookEvent{Key: task.key, ExecuteAt: task.executeAt}
 	if _, ok := t.keyToETask[task.key]; ok {
-		t.removeTask(task.key)
+		t.deleteTask(task.key)
+		t.counters.replaced.Add(1)
+		t.hooks.replace(event)
+	} else {
+		t.hooks.add(event)
 	}
 	eTask := list.PushBack(task)
 	t.keyToETask[task.key] = eTask
+	t.deadlines.push(task)
+	return addResult{}
 }
 
 func (t *TimeWheel) removeTask(key string) {
+	task := t.deleteTask(key)
+	if task == nil {
+		return
+	}
+	t.counters.removed.Add(1)
+	t.hooks.remove(HookEvent{Key: task.key, ExecuteAt: task.executeAt})
+}
+
+// deleteTask 从时间轮中摘除任务节点，任务不存在时返回 nil
+func (t *TimeWheel) deleteTask(key string) *taskElement {
 	eTask, ok := t.keyToETask[key]
 	if !ok {
-		return
+		return nil
 	}
 	delete(t.keyToETask, key)
 	task, _ := eTask.Value.(*taskElement)
 	_ = t.slots[task.pos].Remove(eTask)
+	t.deadlines.remove(task)
+	t.release()
+	return task
 }
 
 // circularIncr 向前移动指针
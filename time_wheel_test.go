@@ -1,6 +1,11 @@
 package timewheel
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
 	"testing"
 	"time"
 )
@@ -44,3 +49,273 @@ func Test_timeWheel(t *testing.T) {
 func isTimeBetween(t time.Time, begin time.Time, end time.Time) bool {
 	return t.After(begin) && t.Before(end)
 }
+
+func Test_timeWheelHooks(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events = make(map[string][]string)
+	)
+	record := func(name string) func(HookEvent) {
+		return func(e HookEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			events[e.Key] = append(events[e.Key], name)
+		}
+	}
+
+	timeWheel := NewTimeWheel(10, 10*time.Millisecond, WithHooks(Hooks{
+		OnAdd:     record("add"),
+		OnReplace: record("replace"),
+		OnRemove:  record("remove"),
+		OnFire:    record("fire"),
+		OnPanic:   record("panic"),
+	}))
+	defer timeWheel.Stop()
+
+	timeWheel.AddTask("fire", func() {}, time.Now().Add(20*time.Millisecond))
+	timeWheel.AddTask("replace", func() {}, time.Now().Add(time.Second))
+	timeWheel.AddTask("replace", func() {}, time.Now().Add(30*time.Millisecond))
+	timeWheel.AddTask("remove", func() {}, time.Now().Add(time.Second))
+	timeWheel.RemoveTask("remove")
+	timeWheel.AddTask("panic", func() { panic("boom") }, time.Now().Add(20*time.Millisecond))
+
+	<-time.After(200 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	expects := map[string][]string{
+		"fire":    {"add", "fire"},
+		"replace": {"add", "replace", "fire"},
+		"remove":  {"add", "remove"},
+		"panic":   {"add", "panic"},
+	}
+	for key, expect := range expects {
+		if got := events[key]; !reflect.DeepEqual(got, expect) {
+			t.Errorf("%s: got %v, expect %v", key, got, expect)
+		}
+	}
+}
+
+func Test_timeWheelStats(t *testing.T) {
+	timeWheel := NewTimeWheel(10, 10*time.Millisecond)
+	defer timeWheel.Stop()
+
+	timeWheel.AddTask("test1", func() {}, time.Now().Add(20*time.Millisecond))
+	timeWheel.AddTask("test2", func() { panic("boom") }, time.Now().Add(20*time.Millisecond))
+	timeWheel.AddTask("test3", func() {}, time.Now().Add(time.Second))
+	timeWheel.AddTask("test3", func() {}, time.Now().Add(time.Second))
+	timeWheel.AddTask("test4", func() {}, time.Now().Add(time.Second))
+	timeWheel.RemoveTask("test4")
+
+	stats := timeWheel.Stats()
+	if stats.Pending != 3 || len(stats.Slots) != 10 {
+		t.Errorf("unexpected stats before fire: %+v", stats)
+	}
+
+	<-time.After(100 * time.Millisecond)
+
+	stats = timeWheel.Stats()
+	if stats.Pending != 1 {
+		t.Errorf("pending: got %d, expect 1", stats.Pending)
+	}
+	var occupied int
+	for _, cnt := range stats.Slots {
+		occupied += cnt
+	}
+	if occupied != stats.Pending {
+		t.Errorf("slots: got %d, expect %d", occupied, stats.Pending)
+	}
+	if stats.Executed != 1 || stats.Panicked != 1 || stats.Replaced != 1 || stats.Removed != 1 {
+		t.Errorf("unexpected counters: %+v", stats)
+	}
+	if total := stats.Lateness.Total(); total != 2 {
+		t.Errorf("lateness samples: got %d, expect 2", total)
+	}
+}
+
+func Test_timeWheelRetry(t *testing.T) {
+	timeWheel := NewTimeWheel(10, 10*time.Millisecond)
+	defer timeWheel.Stop()
+
+	errTask := errors.New("task failed")
+	var (
+		mu       sync.Mutex
+		attempts []int
+		final    = make(chan int, 1)
+	)
+	timeWheel.AddRetryTask(context.Background(), "test1", func(attempt int) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts = append(attempts, attempt)
+		return errTask
+	}, time.Now().Add(10*time.Millisecond), &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 20 * time.Millisecond,
+		Jitter:         0.5,
+		OnFinalFailure: func(key string, attempt int, err error) {
+			if key != "test1" || !errors.Is(err, errTask) {
+				t.Errorf("unexpected final failure: %s, %v", key, err)
+			}
+			final <- attempt
+		},
+	})
+
+	select {
+	case attempt := <-final:
+		if attempt != 3 {
+			t.Errorf("final attempt: got %d, expect 3", attempt)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("final failure callback not called")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(attempts, []int{1, 2, 3}) {
+		t.Errorf("attempts: got %v", attempts)
+	}
+	if stats := timeWheel.Stats(); stats.Failed != 3 || stats.Retried != 2 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func Test_RetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     3,
+	}
+	expects := []time.Duration{100 * time.Millisecond, 300 * time.Millisecond, 900 * time.Millisecond, time.Second}
+	for i, expect := range expects {
+		if got := policy.Backoff(i + 1); got != expect {
+			t.Errorf("attempt %d: got %v, expect %v", i+1, got, expect)
+		}
+	}
+
+	policy.Retryable = func(err error) bool { return !errors.Is(err, context.Canceled) }
+	if policy.shouldRetry(1, context.Canceled) || !policy.shouldRetry(1, errors.New("x")) || policy.shouldRetry(5, errors.New("x")) {
+		t.Error("unexpected shouldRetry result")
+	}
+}
+
+func Test_timeWheelResize(t *testing.T) {
+	timeWheel := NewTimeWheel(4, 50*time.Millisecond)
+	defer timeWheel.Stop()
+
+	start := time.Now()
+	fired := make(chan time.Duration, 3)
+	for i, delay := range []time.Duration{100 * time.Millisecond, 300 * time.Millisecond, 600 * time.Millisecond} {
+		key := fmt.Sprintf("test%d", i)
+		timeWheel.AddTask(key, func() {
+			fired <- time.Since(start) - delay
+		}, start.Add(delay))
+	}
+
+	if err := timeWheel.Resize(64, 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	stats := timeWheel.Stats()
+	if len(stats.Slots) != 64 || stats.Interval != 10*time.Millisecond || stats.Pending != 3 {
+		t.Fatalf("unexpected stats after resize: %+v", stats)
+	}
+	// 延迟直方图按照新的时间间隔分桶
+	bounds := []time.Duration{0, 5 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond}
+	if !reflect.DeepEqual(stats.Lateness.Bounds, bounds) || len(stats.Lateness.Counts) != len(bounds)+1 || stats.Lateness.Total() != 0 {
+		t.Fatalf("unexpected lateness after resize: %+v", stats.Lateness)
+	}
+
+	for i := 0; i < 3; i++ {
+		select {
+		case lateness := <-fired:
+			if lateness < -10*time.Millisecond || lateness > 50*time.Millisecond {
+				t.Errorf("unexpected lateness: %v", lateness)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("task not fired after resize")
+		}
+	}
+	// 调整后的样本记录在新的分桶中
+	lateness := timeWheel.Stats().Lateness
+	if !reflect.DeepEqual(lateness.Bounds, bounds) || lateness.Total() != 3 {
+		t.Errorf("unexpected lateness after fire: %+v", lateness)
+	}
+
+	if err := timeWheel.Resize(0, time.Second); err == nil {
+		t.Error("expect error for invalid slotNum")
+	}
+	timeWheel.Stop()
+	if err := timeWheel.Resize(8, time.Second); !errors.Is(err, ErrStopped) {
+		t.Errorf("got %v, expect ErrStopped", err)
+	}
+}
+
+func Test_timeWheelMaxTasks(t *testing.T) {
+	now := time.Now()
+	noop := func() {}
+
+	t.Run("reject", func(t *testing.T) {
+		timeWheel := NewTimeWheel(10, time.Second, WithMaxTasks(2, OverflowReject))
+		defer timeWheel.Stop()
+
+		_ = timeWheel.AddTask("test1", noop, now.Add(time.Minute))
+		_ = timeWheel.AddTask("test2", noop, now.Add(time.Minute))
+		if err := timeWheel.AddTask("test3", noop, now.Add(time.Minute)); !errors.Is(err, ErrFull) {
+			t.Errorf("got %v, expect ErrFull", err)
+		}
+		// 覆盖已有任务不受容量限制
+		if err := timeWheel.AddTask("test2", noop, now.Add(time.Minute)); err != nil {
+			t.Error(err)
+		}
+		if stats := timeWheel.Stats(); stats.Utilization != 1 || stats.Rejected != 1 {
+			t.Errorf("unexpected stats: %+v", stats)
+		}
+	})
+
+	t.Run("evict", func(t *testing.T) {
+		for _, c := range []struct {
+			policy  OverflowPolicy
+			evicted string
+		}{
+			{OverflowEvictSoonest, "soon"},
+			{OverflowEvictLatest, "late"},
+		} {
+			var evicted []string
+			timeWheel := NewTimeWheel(10, time.Second, WithMaxTasks(2, c.policy), WithHooks(Hooks{
+				OnRemove: func(e HookEvent) {
+					if errors.Is(e.Err, ErrEvicted) {
+						evicted = append(evicted, e.Key)
+					}
+				},
+			}))
+
+			_ = timeWheel.AddTask("soon", noop, now.Add(time.Minute))
+			_ = timeWheel.AddTask("late", noop, now.Add(3*time.Minute))
+			if err := timeWheel.AddTask("new", noop, now.Add(2*time.Minute)); err != nil {
+				t.Error(err)
+			}
+			timeWheel.Stop()
+			if !reflect.DeepEqual(evicted, []string{c.evicted}) {
+				t.Errorf("policy %d: got %v, expect %s", c.policy, evicted, c.evicted)
+			}
+		}
+	})
+
+	t.Run("block", func(t *testing.T) {
+		timeWheel := NewTimeWheel(10, 10*time.Millisecond, WithMaxTasks(1, OverflowBlock))
+		defer timeWheel.Stop()
+
+		_ = timeWheel.AddTask("test1", noop, time.Now().Add(50*time.Millisecond))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := timeWheel.AddTaskContext(ctx, "test2", noop, time.Now()); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got %v, expect DeadlineExceeded", err)
+		}
+
+		// test1 执行后释放容量
+		if err := timeWheel.AddTaskContext(context.Background(), "test2", noop, time.Now()); err != nil {
+			t.Error(err)
+		}
+	})
+}
@@ -0,0 +1,110 @@
+package timewheel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"time"
+
+	"github.com/dej4vu/timewheel/pkg/codec"
+)
+
+// TaskTyper 类型化任务的内容实现该接口时，以 TaskType 的返回值作为任务类型
+type TaskTyper interface {
+	TaskType() string
+}
+
+// TypedOption 类型化任务的可选配置
+type TypedOption func(o *typedOptions)
+
+type typedOptions struct {
+	codec   codec.Codec
+	headers map[string]string
+}
+
+// WithHeaders 设置类型化任务的 Headers
+func WithHeaders(headers map[string]string) TypedOption {
+	return func(o *typedOptions) {
+		o.headers = maps.Clone(headers)
+	}
+}
+
+// WithCodec 设置类型化任务内容的编解码器，默认为 codec.JSON
+// 执行时按照任务中记录的编解码器名称解码，执行任务的实例需要注册相同名称的编解码器
+func WithCodec(c codec.Codec) TypedOption {
+	return func(o *typedOptions) {
+		if c != nil {
+			o.codec = c
+		}
+	}
+}
+
+// TypeOf 类型化任务的任务类型. T 实现 TaskTyper 时使用 TaskType 的返回值，否则使用 T 的类型名称，指针类型与其指向的类型相同
+func TypeOf[T any]() string {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if typer, ok := reflect.New(t).Interface().(TaskTyper); ok {
+		return typer.TaskType()
+	}
+	return t.String()
+}
+
+// AddTyped 添加类型化任务，任务类型为 TypeOf[T]()，任务内容由编解码器编码后写入
+func AddTyped[T any](ctx context.Context, r *RTimeWheel, key string, payload T, executeAt time.Time, opts ...TypedOption) error {
+	o := typedOptions{codec: codec.JSON}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	data, err := o.codec.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal payload: %w", err)
+	}
+	return r.AddTask(ctx, key, &RTaskElement{
+		Type:    TypeOf[T](),
+		Codec:   o.codec.Name(),
+		Payload: data,
+		Headers: o.headers,
+	}, executeAt)
+}
+
+// DecodePayload 解码任务内容
+// 兼容通过 AddTask 写入的任务：T 为 string 时直接返回 Msg，否则将 Msg 作为 json 解码
+func DecodePayload[T any](task *RTaskElement) (T, error) {
+	var payload T
+	if task.Codec == "" && len(task.Payload) == 0 {
+		if msg, ok := any(&payload).(*string); ok {
+			*msg = task.Msg
+			return payload, nil
+		}
+		err := json.Unmarshal([]byte(task.Msg), &payload)
+		return payload, err
+	}
+
+	c, ok := codec.Get(task.Codec)
+	if !ok {
+		return payload, fmt.Errorf("codec %q not registered", task.Codec)
+	}
+	err := c.Unmarshal(task.Payload, &payload)
+	return payload, err
+}
+
+// HandleTyped 将类型化任务的处理函数转换为 HandlerFunc. 任务内容无法解码时不再重试，直接转入死信队列
+func HandleTyped[T any](fn func(ctx context.Context, payload T) error) HandlerFunc {
+	return func(ctx context.Context, task *RTaskElement) error {
+		payload, err := DecodePayload[T](task)
+		if err != nil {
+			return Permanent(fmt.Errorf("decode payload of task %s: %w", task.Key, err))
+		}
+		return fn(ctx, payload)
+	}
+}
+
+// HandleTypedFunc 在 Mux 中注册任务类型 TypeOf[T]() 的处理函数
+func HandleTypedFunc[T any](m *Mux, fn func(ctx context.Context, payload T) error, opts ...HandlerOption) {
+	m.Handle(TypeOf[T](), HandleTyped(fn), opts...)
+}
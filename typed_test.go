@@ -0,0 +1,136 @@
+package timewheel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dej4vu/timewheel/pkg/backend"
+	"github.com/dej4vu/timewheel/pkg/backend/memory"
+	"github.com/dej4vu/timewheel/pkg/codec"
+)
+
+type orderTimeout struct {
+	OrderID string `json:"orderId" msgpack:"orderId"`
+	Amount  int64  `json:"amount" msgpack:"amount"`
+}
+
+type namedPayload struct{}
+
+func (*namedPayload) TaskType() string { return "named" }
+
+func Test_TypeOf(t *testing.T) {
+	if got := TypeOf[orderTimeout](); got != "timewheel.orderTimeout" {
+		t.Errorf("TypeOf = %s", got)
+	}
+	if got := TypeOf[*orderTimeout](); got != "timewheel.orderTimeout" {
+		t.Errorf("TypeOf pointer = %s", got)
+	}
+	if TypeOf[namedPayload]() != "named" || TypeOf[*namedPayload]() != "named" {
+		t.Errorf("TypeOf should use TaskType")
+	}
+}
+
+// Test_DecodePayload_Codecs msgpack、protobuf 编解码器的测试位于各自的模块中
+func Test_DecodePayload_Codecs(t *testing.T) {
+	want := orderTimeout{OrderID: "o1", Amount: 100}
+	data, err := codec.JSON.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodePayload[orderTimeout](&RTaskElement{Codec: codec.JSON.Name(), Payload: data})
+	if err != nil || got != want {
+		t.Errorf("%s: got = %+v, %v, want %+v", codec.JSON.Name(), got, err, want)
+	}
+
+	if _, err := DecodePayload[orderTimeout](&RTaskElement{Codec: "unknown", Payload: data}); err == nil {
+		t.Error("unknown codec should fail")
+	}
+}
+
+// Test_DecodePayload_Legacy 兼容通过 AddTask 写入，以 json 编码在 Msg 中的任务内容
+func Test_DecodePayload_Legacy(t *testing.T) {
+	body := `{"key":"legacy","msg":"{\"orderId\":\"o1\",\"amount\":100}","type":"test","executeAtUnix":1700000000}`
+	var task RTaskElement
+	if err := json.Unmarshal([]byte(body), &task); err != nil {
+		t.Fatal(err)
+	}
+	if task.Version != 0 {
+		t.Errorf("version = %d, want 0", task.Version)
+	}
+	got, err := DecodePayload[orderTimeout](&task)
+	if err != nil || got != (orderTimeout{OrderID: "o1", Amount: 100}) {
+		t.Errorf("got = %+v, %v", got, err)
+	}
+	if msg, err := DecodePayload[string](&task); err != nil || msg != task.Msg {
+		t.Errorf("msg = %q, %v, want %q", msg, err, task.Msg)
+	}
+}
+
+func Test_RTimeWheel_Typed(t *testing.T) {
+	ctx := context.Background()
+	b := memory.New()
+	var (
+		mu       sync.Mutex
+		executed []orderTimeout
+	)
+	mux := NewMux()
+	HandleTypedFunc(mux, func(ctx context.Context, payload orderTimeout) error {
+		mu.Lock()
+		executed = append(executed, payload)
+		mu.Unlock()
+		return nil
+	})
+	rTimeWheel := NewRTimeWheelWithBackend(b, mux.Execute, WithPollInterval(100*time.Millisecond))
+	defer rTimeWheel.Stop()
+
+	executeAt := time.Now().Add(500 * time.Millisecond)
+	want := []orderTimeout{{OrderID: "o1", Amount: 1}, {OrderID: "o2", Amount: 2}}
+	if err := AddTyped(ctx, rTimeWheel, "o1", want[0], executeAt); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddTyped(ctx, rTimeWheel, "o2", want[1], executeAt.Add(100*time.Millisecond), WithCodec(codec.JSON)); err != nil {
+		t.Fatal(err)
+	}
+	// 更高版本写入的任务不会被执行，保留原始内容转入死信队列
+	future, _ := json.Marshal(map[string]interface{}{
+		"key": "future", "msg": "{}", "type": TypeOf[orderTimeout](), "version": envelopeVersion + 1,
+		"executeAtUnixMilli": executeAt.UnixMilli(), "futureField": "kept",
+	})
+	if _, err := b.Add(ctx, backend.Task{Key: "future", ExecuteAt: executeAt, Body: string(future)}); err != nil {
+		t.Fatal(err)
+	}
+
+	<-time.After(1500 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(executed, want) {
+		t.Errorf("executed = %+v, want %+v", executed, want)
+	}
+
+	if stats := rTimeWheel.Stats(); stats.Unsupported != 1 {
+		t.Errorf("unsupported = %d, want 1", stats.Unsupported)
+	}
+	deadLetters, err := rTimeWheel.ListDeadLetters(ctx, 0, 10)
+	if err != nil || len(deadLetters) != 1 || deadLetters[0].Task.Key != "future" {
+		t.Fatalf("dead letters = %+v, %v", deadLetters, err)
+	}
+	if !strings.Contains(deadLetters[0].Error, ErrUnsupportedVersion.Error()) {
+		t.Errorf("dead letter error = %s", deadLetters[0].Error)
+	}
+	var raw struct {
+		Task map[string]interface{} `json:"task"`
+	}
+	if err := json.Unmarshal([]byte(deadLetters[0].body), &raw); err != nil || raw.Task["futureField"] != "kept" {
+		t.Errorf("dead letter task = %v, %v, want the original body", raw.Task, err)
+	}
+	// 当前版本无法重新挂载更高版本写入的任务
+	if err := rTimeWheel.RequeueDeadLetter(ctx, deadLetters[0], time.Now()); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("requeue err = %v, want ErrUnsupportedVersion", err)
+	}
+}